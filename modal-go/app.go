@@ -3,6 +3,7 @@ package modal
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
@@ -10,10 +11,18 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// appHeartbeatInterval is how often ephemeral Apps send heartbeats. Modal
+// stops ephemeral Apps that miss heartbeats for a while.
+const appHeartbeatInterval = 15 * time.Second
+
 // App references a deployed Modal App.
 type App struct {
 	AppId string
 	ctx   context.Context
+
+	cancel    context.CancelFunc // only for ephemeral apps
+	ephemeral bool
+	closeOnce sync.Once
 }
 
 // LookupOptions are options for finding deployed Modal objects.
@@ -27,6 +36,12 @@ type DeleteOptions struct {
 	Environment string // Environment to delete the object from.
 }
 
+// AppEphemeralOptions are options for creating an ephemeral App.
+type AppEphemeralOptions struct {
+	Name        string // Name shown in the Modal dashboard.
+	Environment string // Environment to create the App in.
+}
+
 // EphemeralOptions are options for creating a temporary, nameless object.
 type EphemeralOptions struct {
 	Environment string // Environment to create the object in.
@@ -40,14 +55,23 @@ type SandboxOptions struct {
 	Command          []string           // Command to run in the Sandbox on startup.
 	Secrets          []*Secret          // Secrets to inject into the Sandbox.
 	Volumes          map[string]*Volume // Mount points for Volumes.
+	Mounts           []*Mount           // Local files to add to the Sandbox, created with MountFromLocalDir.
 	EncryptedPorts   []int              // List of encrypted ports to tunnel into the sandbox, with TLS encryption.
 	H2Ports          []int              // List of encrypted ports to tunnel into the sandbox, using HTTP/2.
 	UnencryptedPorts []int              // List of ports to tunnel into the sandbox without encryption.
+	EnableSnapshot   bool               // Allow memory snapshots of the Sandbox with Sandbox.Snapshot().
+
+	// TerminateOnContextDone terminates the Sandbox when the context passed to
+	// CreateSandboxContext is cancelled, or the context of the App for
+	// CreateSandbox, so that Sandboxes don't outlive the work they were
+	// created for.
+	TerminateOnContextDone bool
 }
 
 // ImageFromRegistryOptions are options for creating an Image from a registry.
 type ImageFromRegistryOptions struct {
-	Secret *Secret // Secret for private registry authentication.
+	Secret *Secret            // Secret for private registry authentication.
+	Build  *ImageBuildOptions // Options for building the Image.
 }
 
 // AppLookup looks up an existing App, or creates an empty one.
@@ -82,8 +106,87 @@ func AppLookup(ctx context.Context, name string, options *LookupOptions) (*App,
 	return &App{AppId: resp.GetAppId(), ctx: ctx}, nil
 }
 
+// AppEphemeral creates a temporary App, like `app.run()` in Python. Caller
+// must Close the App, which stops it with all of its Sandboxes and objects.
+func AppEphemeral(ctx context.Context, options *AppEphemeralOptions) (*App, error) {
+	if options == nil {
+		options = &AppEphemeralOptions{}
+	}
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.AppCreate(ctx, pb.AppCreateRequest_builder{
+		Description:     options.Name,
+		EnvironmentName: environmentName(options.Environment),
+		AppState:        pb.AppState_APP_STATE_EPHEMERAL,
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeatCtx, cancel := context.WithCancel(ctx)
+	app := &App{AppId: resp.GetAppId(), ctx: ctx, cancel: cancel, ephemeral: true}
+
+	go func() {
+		t := time.NewTicker(appHeartbeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-t.C:
+				_, _ = client.AppHeartbeat(heartbeatCtx, pb.AppHeartbeatRequest_builder{
+					AppId: app.AppId,
+				}.Build()) // ignore errors – next call will retry or context will cancel
+			}
+		}
+	}()
+
+	return app, nil
+}
+
+// Close stops an ephemeral App created with AppEphemeral, which terminates
+// its Sandboxes and deletes its objects. Closing an App again is a no-op.
+func (app *App) Close() error {
+	if !app.ephemeral {
+		return InvalidError{fmt.Sprintf("app %s is not ephemeral", app.AppId)}
+	}
+	var err error
+	app.closeOnce.Do(func() {
+		app.cancel() // will stop heartbeat
+
+		// Stop the App even if its context was cancelled.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(app.ctx), terminateTimeout)
+		defer cancel()
+		_, err = client.AppClientDisconnect(ctx, pb.AppClientDisconnectRequest_builder{
+			AppId:  app.AppId,
+			Reason: pb.AppDisconnectReason_APP_DISCONNECT_REASON_ENTRYPOINT_COMPLETED,
+		}.Build())
+	})
+	return err
+}
+
 // CreateSandbox creates a new Sandbox in the App with the specified image and options.
 func (app *App) CreateSandbox(image *Image, options *SandboxOptions) (*Sandbox, error) {
+	return app.CreateSandboxContext(app.ctx, image, options)
+}
+
+// CreateSandboxContext is like CreateSandbox, but builds the Image if needed
+// and creates the Sandbox with ctx, which SandboxOptions.TerminateOnContextDone
+// binds the Sandbox to. This
+// allows Sandboxes to be tied to a request or job, instead of to the App.
+func (app *App) CreateSandboxContext(ctx context.Context, image *Image, options *SandboxOptions) (*Sandbox, error) {
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := image.build(ctx, app, nil); err != nil {
+		return nil, err
+	}
 	if options == nil {
 		options = &SandboxOptions{}
 	}
@@ -136,7 +239,7 @@ func (app *App) CreateSandbox(image *Image, options *SandboxOptions) (*Sandbox,
 		}
 	}
 
-	createResp, err := client.SandboxCreate(app.ctx, pb.SandboxCreateRequest_builder{
+	createResp, err := client.SandboxCreate(ctx, pb.SandboxCreateRequest_builder{
 		AppId: app.AppId,
 		Definition: pb.Sandbox_builder{
 			EntrypointArgs: options.Command,
@@ -150,8 +253,10 @@ func (app *App) CreateSandbox(image *Image, options *SandboxOptions) (*Sandbox,
 				MilliCpu: uint32(1000 * options.CPU),
 				MemoryMb: uint32(options.Memory),
 			}.Build(),
-			VolumeMounts: volumeMounts,
-			OpenPorts:    portSpecs,
+			VolumeMounts:   volumeMounts,
+			MountIds:       mountIds(options.Mounts),
+			OpenPorts:      portSpecs,
+			EnableSnapshot: options.EnableSnapshot,
 		}.Build(),
 	}.Build())
 
@@ -159,38 +264,32 @@ func (app *App) CreateSandbox(image *Image, options *SandboxOptions) (*Sandbox,
 		return nil, err
 	}
 
-	return newSandbox(app.ctx, createResp.GetSandboxId()), nil
+	sb := newSandbox(app.ctx, createResp.GetSandboxId())
+	sb.AppId = app.AppId
+	if options.TerminateOnContextDone {
+		sb.terminateOnContextDone(ctx)
+	}
+	return sb, nil
 }
 
 // ImageFromRegistry creates an Image from a registry tag.
 func (app *App) ImageFromRegistry(tag string, options *ImageFromRegistryOptions) (*Image, error) {
-	if options == nil {
-		options = &ImageFromRegistryOptions{}
-	}
-	var imageRegistryConfig *pb.ImageRegistryConfig
-	if options.Secret != nil {
-		imageRegistryConfig = pb.ImageRegistryConfig_builder{
-			RegistryAuthType: pb.RegistryAuthType_REGISTRY_AUTH_TYPE_STATIC_CREDS,
-			SecretId:         options.Secret.SecretId,
-		}.Build()
-	}
-	return fromRegistryInternal(app, tag, imageRegistryConfig)
+	return app.buildImage(ImageFromRegistry(tag, options))
 }
 
 // ImageFromAwsEcr creates an Image from an AWS ECR tag.
 func (app *App) ImageFromAwsEcr(tag string, secret *Secret) (*Image, error) {
-	imageRegistryConfig := pb.ImageRegistryConfig_builder{
-		RegistryAuthType: pb.RegistryAuthType_REGISTRY_AUTH_TYPE_AWS,
-		SecretId:         secret.SecretId,
-	}.Build()
-	return fromRegistryInternal(app, tag, imageRegistryConfig)
+	return app.buildImage(ImageFromAwsEcr(tag, secret))
 }
 
 // ImageFromGcpArtifactRegistry creates an Image from a GCP Artifact Registry tag.
 func (app *App) ImageFromGcpArtifactRegistry(tag string, secret *Secret) (*Image, error) {
-	imageRegistryConfig := pb.ImageRegistryConfig_builder{
-		RegistryAuthType: pb.RegistryAuthType_REGISTRY_AUTH_TYPE_GCP,
-		SecretId:         secret.SecretId,
-	}.Build()
-	return fromRegistryInternal(app, tag, imageRegistryConfig)
+	return app.buildImage(ImageFromGcpArtifactRegistry(tag, secret))
+}
+
+func (app *App) buildImage(image *Image) (*Image, error) {
+	if err := image.build(app.ctx, app, nil); err != nil {
+		return nil, err
+	}
+	return image, nil
 }
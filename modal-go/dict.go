@@ -0,0 +1,240 @@
+package modal
+
+// Dict object, to be used with Modal Dicts.
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DictPutOptions are options for Dict.Put.
+type DictPutOptions struct {
+	SkipIfExists bool // don't overwrite the value if the key exists
+}
+
+// Dict is a distributed key-value store for Modal apps.
+//
+// Keys and values are pickled. String keys are pickled exactly like Python
+// does, so they refer to the same entries as in Python Modal Functions.
+type Dict struct {
+	DictId    string
+	cancel    context.CancelFunc // only for ephemeral dicts
+	ephemeral bool
+	ctx       context.Context
+}
+
+// DictEphemeral creates a nameless, temporary dict. Caller must CloseEphemeral.
+func DictEphemeral(ctx context.Context, options *EphemeralOptions) (*Dict, error) {
+	if options == nil {
+		options = &EphemeralOptions{}
+	}
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.DictGetOrCreate(ctx, pb.DictGetOrCreateRequest_builder{
+		ObjectCreationType: pb.ObjectCreationType_OBJECT_CREATION_TYPE_EPHEMERAL,
+		EnvironmentName:    environmentName(options.Environment),
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeatCtx, cancel := context.WithCancel(ctx)
+	d := &Dict{DictId: resp.GetDictId(), cancel: cancel, ephemeral: true, ctx: ctx}
+
+	go func() {
+		t := time.NewTicker(ephemeralObjectHeartbeatSleep)
+		defer t.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-t.C:
+				_, _ = client.DictHeartbeat(heartbeatCtx, pb.DictHeartbeatRequest_builder{
+					DictId: d.DictId,
+				}.Build()) // ignore errors – next call will retry or context will cancel
+			}
+		}
+	}()
+
+	return d, nil
+}
+
+// CloseEphemeral deletes an ephemeral dict, only used with DictEphemeral.
+func (d *Dict) CloseEphemeral() {
+	if d.ephemeral {
+		d.cancel() // will stop heartbeat
+	} else {
+		panic(fmt.Sprintf("dict %s is not ephemeral", d.DictId))
+	}
+}
+
+// DictLookup returns a handle to a (possibly new) dict by deployment name.
+func DictLookup(ctx context.Context, name string, options *LookupOptions) (*Dict, error) {
+	if options == nil {
+		options = &LookupOptions{}
+	}
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	creationType := pb.ObjectCreationType_OBJECT_CREATION_TYPE_UNSPECIFIED
+	if options.CreateIfMissing {
+		creationType = pb.ObjectCreationType_OBJECT_CREATION_TYPE_CREATE_IF_MISSING
+	}
+
+	resp, err := client.DictGetOrCreate(ctx, pb.DictGetOrCreateRequest_builder{
+		DeploymentName:     name,
+		EnvironmentName:    environmentName(options.Environment),
+		ObjectCreationType: creationType,
+	}.Build())
+	if status, ok := status.FromError(err); ok && status.Code() == codes.NotFound {
+		return nil, NotFoundError{fmt.Sprintf("dict '%s' not found", name)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Dict{ctx: ctx, DictId: resp.GetDictId()}, nil
+}
+
+// DictDelete removes a dict by name.
+func DictDelete(ctx context.Context, name string, options *DeleteOptions) error {
+	if options == nil {
+		options = &DeleteOptions{}
+	}
+	d, err := DictLookup(ctx, name, &LookupOptions{Environment: options.Environment})
+	if err != nil {
+		return err
+	}
+	_, err = client.DictDelete(d.ctx, pb.DictDeleteRequest_builder{DictId: d.DictId}.Build())
+	return err
+}
+
+// Get returns the value for a key, and whether the key exists.
+func (d *Dict) Get(key any) (any, bool, error) {
+	k, err := dictKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := client.DictGet(d.ctx, pb.DictGetRequest_builder{DictId: d.DictId, Key: k}.Build())
+	if err != nil || !resp.GetFound() {
+		return nil, false, err
+	}
+	v, err := pickleDeserialize(resp.GetValue())
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+// Put sets the value for a key, and returns whether it was set, which is
+// only false if options.SkipIfExists is set and the key exists. Setting a key
+// with SkipIfExists is atomic, so exactly one of concurrent callers succeeds.
+func (d *Dict) Put(key, value any, options *DictPutOptions) (bool, error) {
+	if options == nil {
+		options = &DictPutOptions{}
+	}
+	k, err := dictKey(key)
+	if err != nil {
+		return false, err
+	}
+	v, err := pickleSerialize(value)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.DictUpdate(d.ctx, pb.DictUpdateRequest_builder{
+		DictId:      d.DictId,
+		Updates:     []*pb.DictEntry{pb.DictEntry_builder{Key: k, Value: v.Bytes()}.Build()},
+		IfNotExists: options.SkipIfExists,
+	}.Build())
+	if err != nil {
+		return false, err
+	}
+	return resp.GetCreated(), nil
+}
+
+// Pop removes a key and returns its value, and whether the key existed.
+func (d *Dict) Pop(key any) (any, bool, error) {
+	k, err := dictKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := client.DictPop(d.ctx, pb.DictPopRequest_builder{DictId: d.DictId, Key: k}.Build())
+	if err != nil || !resp.GetFound() {
+		return nil, false, err
+	}
+	v, err := pickleDeserialize(resp.GetValue())
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+// Contains returns whether a key exists.
+func (d *Dict) Contains(key any) (bool, error) {
+	k, err := dictKey(key)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.DictContains(d.ctx, pb.DictContainsRequest_builder{DictId: d.DictId, Key: k}.Build())
+	if err != nil {
+		return false, err
+	}
+	return resp.GetFound(), nil
+}
+
+// Len returns the number of keys in the dict.
+func (d *Dict) Len() (int, error) {
+	resp, err := client.DictLen(d.ctx, pb.DictLenRequest_builder{DictId: d.DictId}.Build())
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.GetLen()), nil
+}
+
+// Clear removes all keys from the dict.
+func (d *Dict) Clear() error {
+	_, err := client.DictClear(d.ctx, pb.DictClearRequest_builder{DictId: d.DictId}.Build())
+	return err
+}
+
+// dictKey pickles a key. Entries are found by the bytes of their pickled key,
+// so string keys are pickled like Python's pickle.dumps(key, protocol=4) to
+// share entries with Python.
+func dictKey(key any) ([]byte, error) {
+	s, ok := key.(string)
+	if !ok || !utf8.ValidString(s) || len(s) >= 64*1024 {
+		b, err := pickleSerialize(key)
+		if err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	// The opcodes are framed, and the string is memoized.
+	var ops []byte
+	if len(s) < 256 {
+		ops = append(ops, 0x8c, byte(len(s))) // SHORT_BINUNICODE
+	} else {
+		ops = append(ops, 'X') // BINUNICODE
+		ops = binary.LittleEndian.AppendUint32(ops, uint32(len(s)))
+	}
+	ops = append(ops, s...)
+	ops = append(ops, 0x94, '.') // MEMOIZE, STOP
+
+	out := []byte{0x80, 4, 0x95} // PROTO 4, FRAME
+	out = binary.LittleEndian.AppendUint64(out, uint64(len(ops)))
+	return append(out, ops...), nil
+}
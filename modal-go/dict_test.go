@@ -0,0 +1,44 @@
+package modal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestDictKey(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	// Outputs of pickle.dumps(key, protocol=4) in Python.
+	for key, want := range map[string]string{
+		"":       "\x80\x04\x95\x04\x00\x00\x00\x00\x00\x00\x00\x8c\x00\x94.",
+		"lock:1": "\x80\x04\x95\x0a\x00\x00\x00\x00\x00\x00\x00\x8c\x06lock:1\x94.",
+		"é":      "\x80\x04\x95\x06\x00\x00\x00\x00\x00\x00\x00\x8c\x02\xc3\xa9\x94.",
+	} {
+		got, err := dictKey(key)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		g.Expect(string(got)).Should(gomega.Equal(want), key)
+	}
+
+	long, err := dictKey(strings.Repeat("x", 300))
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(long[:16])).Should(gomega.Equal("\x80\x04\x953\x01\x00\x00\x00\x00\x00\x00X,\x01\x00\x00"))
+	g.Expect(len(long)).Should(gomega.Equal(318))
+
+	for _, key := range []string{"lock:1", strings.Repeat("x", 300)} {
+		b, err := dictKey(key)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		v, err := pickleDeserialize(b)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		g.Expect(v).Should(gomega.Equal(key))
+	}
+
+	// Other keys are pickled as usual.
+	b, err := dictKey(int64(5))
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	v, err := pickleDeserialize(b)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(v).Should(gomega.Equal(int64(5)))
+}
@@ -0,0 +1,102 @@
+package modal
+
+// dotenv.go parses .env files for SecretFromDotenv.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseDotenv parses the contents of a .env file, with the syntax supported
+// by python-dotenv except for variable expansion:
+//
+//	# comment
+//	KEY=value # comment
+//	export KEY='literal value'
+//	KEY="value with \"escapes\" \n and
+//	lines"
+func parseDotenv(data string) (map[string]string, error) {
+	values := map[string]string{}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	lineNum := 0
+	for len(data) > 0 {
+		var line string
+		line, data, _ = strings.Cut(data, "\n")
+		lineNum++
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t'\"") {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNum)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value == "" || (value[0] != '\'' && value[0] != '"') {
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			values[key] = strings.TrimSpace(value)
+			continue
+		}
+
+		// Quoted values may span lines, so parse the rest of the input.
+		startLine := lineNum
+		rest := value
+		if len(data) > 0 {
+			rest += "\n" + data
+		}
+		parsed, n, err := parseDotenvQuoted(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", startLine, err)
+		}
+		lineNum += strings.Count(rest[:n], "\n")
+		trailing, remaining, _ := strings.Cut(rest[n:], "\n")
+		if trailing = strings.TrimSpace(trailing); trailing != "" && !strings.HasPrefix(trailing, "#") {
+			return nil, fmt.Errorf("line %d: unexpected characters after quoted value", lineNum)
+		}
+		values[key] = parsed
+		data = remaining
+	}
+	return values, nil
+}
+
+// parseDotenvQuoted parses a quoted value at the start of s, and returns it
+// with the number of bytes consumed. Single-quoted values are literal, while
+// double-quoted values support backslash escapes.
+func parseDotenvQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '\\', '"', '\'':
+				sb.WriteByte(s[i])
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(s[i])
+			}
+		case c == '\\' && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+			sb.WriteByte('\'')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated %c-quoted value", quote)
+}
@@ -0,0 +1,51 @@
+package modal
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestParseDotenv(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	values, err := parseDotenv(`# database
+DB_HOST=localhost
+DB_PORT = 5432 # default port
+export API_KEY='abc#def'
+EMPTY=
+GREETING="hello\n\"world\"" # comment
+CERT="-----BEGIN-----
+line
+-----END-----"
+URL=https://example.com/#anchor
+`)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(values).Should(gomega.Equal(map[string]string{
+		"DB_HOST":  "localhost",
+		"DB_PORT":  "5432",
+		"API_KEY":  "abc#def",
+		"EMPTY":    "",
+		"GREETING": "hello\n\"world\"",
+		"CERT":     "-----BEGIN-----\nline\n-----END-----",
+		"URL":      "https://example.com/#anchor",
+	}))
+
+	values, err = parseDotenv("A=1\r\nB='x'\r\n")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(values).Should(gomega.Equal(map[string]string{"A": "1", "B": "x"}))
+
+	for _, invalid := range []string{
+		"NO_EQUALS",
+		"=value",
+		"A='unterminated",
+		"A=\"x\" trailing",
+	} {
+		_, err := parseDotenv(invalid)
+		g.Expect(err).Should(gomega.HaveOccurred(), invalid)
+	}
+
+	_, err = parseDotenv("A=1\nB=\"two\nlines\" x\n")
+	g.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("line 3")))
+}
@@ -47,6 +47,15 @@ func (e NotFoundError) Error() string {
 	return "NotFoundError: " + e.Exception
 }
 
+// AlreadyExistsError is returned when creating an object that already exists.
+type AlreadyExistsError struct {
+	Exception string
+}
+
+func (e AlreadyExistsError) Error() string {
+	return "AlreadyExistsError: " + e.Exception
+}
+
 // InvalidError represents an invalid request or operation.
 type InvalidError struct {
 	Exception string
@@ -91,3 +100,36 @@ type SandboxTimeoutError struct {
 func (e SandboxTimeoutError) Error() string {
 	return "SandboxTimeoutError: " + e.Exception
 }
+
+// SandboxTerminatedError is returned when an operation that needs a running
+// sandbox is attempted after the sandbox was terminated or has exited.
+type SandboxTerminatedError struct {
+	Exception string
+}
+
+func (e SandboxTerminatedError) Error() string {
+	return "SandboxTerminatedError: " + e.Exception
+}
+
+// ImageBuildTimeoutError is returned when an Image build exceeds its timeout.
+type ImageBuildTimeoutError struct {
+	Exception string
+}
+
+func (e ImageBuildTimeoutError) Error() string {
+	return "ImageBuildTimeoutError: " + e.Exception
+}
+
+// QueueDecodeError is returned for a queue item that could not be decoded.
+type QueueDecodeError struct {
+	Data []byte // Encoded item.
+	Err  error  // Error of the codec.
+}
+
+func (e QueueDecodeError) Error() string {
+	return "QueueDecodeError: " + e.Err.Error()
+}
+
+func (e QueueDecodeError) Unwrap() error {
+	return e.Err
+}
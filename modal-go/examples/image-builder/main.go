@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/modal-labs/libmodal/modal-go"
+)
+
+func main() {
+	ctx := context.Background()
+
+	app, err := modal.AppLookup(ctx, "libmodal-example", &modal.LookupOptions{CreateIfMissing: true})
+	if err != nil {
+		log.Fatalf("Failed to lookup or create app: %v", err)
+	}
+
+	base, err := app.ImageFromRegistry("python:3.13-slim", nil)
+	if err != nil {
+		log.Fatalf("Failed to create image from registry: %v", err)
+	}
+
+	// Layers are built when the image is first used to create a sandbox.
+	image := base.
+		AptInstall("curl").
+		PipInstall("requests").
+		Env(map[string]string{"GREETING": "Hello from a layered image!"}).
+		Workdir("/app")
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command: []string{"python", "-c", "import os, requests; print(os.environ['GREETING'], requests.__version__)"},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create sandbox: %v", err)
+	}
+	log.Println("Started sandbox:", sb.SandboxId, "with image:", image.ImageId)
+	defer sb.Terminate()
+
+	output, err := io.ReadAll(sb.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to read stdout: %v", err)
+	}
+	log.Print(string(output))
+}
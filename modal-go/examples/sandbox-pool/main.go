@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+)
+
+func main() {
+	ctx := context.Background()
+
+	app, err := modal.AppLookup(ctx, "libmodal-example", &modal.LookupOptions{CreateIfMissing: true})
+	if err != nil {
+		log.Fatalf("Failed to lookup or create app: %v", err)
+	}
+
+	image, err := app.ImageFromRegistry("python:3.13-slim", nil)
+	if err != nil {
+		log.Fatalf("Failed to create image from registry: %v", err)
+	}
+
+	pool, err := modal.NewSandboxPool(app, image, &modal.SandboxPoolOptions{
+		Size:    2,
+		MaxSize: 4,
+		MaxAge:  10 * time.Minute,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create sandbox pool: %v", err)
+	}
+	defer pool.Close()
+
+	for i := range 3 {
+		start := time.Now()
+		sb, err := pool.Acquire(ctx)
+		if err != nil {
+			log.Fatalf("Failed to acquire sandbox: %v", err)
+		}
+		log.Printf("Acquired sandbox %s in %s", sb.SandboxId, time.Since(start))
+
+		p, err := sb.Exec([]string{"python", "-c", "print(sum(range(1_000_000)))"}, modal.ExecOptions{})
+		if err != nil {
+			log.Fatalf("Failed to execute command: %v", err)
+		}
+		output, err := io.ReadAll(p.Stdout)
+		if err != nil {
+			log.Fatalf("Failed to read stdout: %v", err)
+		}
+		log.Printf("Request %d output: %s", i, output)
+
+		// Sandboxes that ran untrusted code should not be reused.
+		if err := pool.Release(sb, false); err != nil {
+			log.Fatalf("Failed to release sandbox: %v", err)
+		}
+	}
+}
@@ -2,34 +2,178 @@ package modal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"time"
 
 	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Image represents a Modal image, which can be used to create sandboxes.
 type Image struct {
-	ImageId string
+	ImageId  string         // Empty until a layered Image is built.
+	Metadata *ImageMetadata // Contents of the Image, if known.
 
 	//lint:ignore U1000 may be used in future
 	ctx context.Context
+
+	mu           sync.Mutex
+	base         *Image             // Image the layer is built on top of, if any
+	layer        *imageLayer        // definition of an Image that is built on first use
+	buildOptions *ImageBuildOptions // default options for building the layer
+}
+
+// ImageMetadata describes the contents of a built Image.
+type ImageMetadata struct {
+	PythonVersion  string            // Output of `python -VV`, if Python is installed.
+	PythonPackages map[string]string // Installed Python packages and their versions.
+	Workdir        string            // Working directory of the Image, if set.
+	LibcVersion    string            // Version of glibc, if any.
+	BuilderVersion string            // Image builder version the Image was built with.
+}
+
+func imageMetadataFromProto(metadata *pb.ImageMetadata) *ImageMetadata {
+	if metadata == nil {
+		return nil
+	}
+	return &ImageMetadata{
+		PythonVersion:  metadata.GetPythonVersionInfo(),
+		PythonPackages: metadata.GetPythonPackages(),
+		Workdir:        metadata.GetWorkdir(),
+		LibcVersion:    metadata.GetLibcVersionInfo(),
+		BuilderVersion: metadata.GetImageBuilderVersion(),
+	}
+}
+
+// ImageFromId looks up an Image that was built before by its ID.
+func ImageFromId(ctx context.Context, imageId string) (*Image, error) {
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.ImageFromId(ctx, pb.ImageFromIdRequest_builder{
+		ImageId: imageId,
+	}.Build())
+	if status, ok := status.FromError(err); ok && status.Code() == codes.NotFound {
+		return nil, NotFoundError{fmt.Sprintf("Image '%s' not found", imageId)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		ImageId:  resp.GetImageId(),
+		Metadata: imageMetadataFromProto(resp.GetMetadata()),
+		ctx:      ctx,
+	}, nil
+}
+
+// ImageFromRegistry returns an Image from a registry tag. The Image is built
+// in the App it is first used with in CreateSandbox, or with Image.Build.
+func ImageFromRegistry(tag string, options *ImageFromRegistryOptions) *Image {
+	if options == nil {
+		options = &ImageFromRegistryOptions{}
+	}
+	var imageRegistryConfig *pb.ImageRegistryConfig
+	if options.Secret != nil {
+		imageRegistryConfig = pb.ImageRegistryConfig_builder{
+			RegistryAuthType: pb.RegistryAuthType_REGISTRY_AUTH_TYPE_STATIC_CREDS,
+			SecretId:         options.Secret.SecretId,
+		}.Build()
+	}
+	return imageFromRegistryConfig(tag, imageRegistryConfig, options.Build)
+}
+
+// ImageFromAwsEcr returns an Image from an AWS ECR tag. The Image is built in
+// the App it is first used with in CreateSandbox, or with Image.Build.
+func ImageFromAwsEcr(tag string, secret *Secret) *Image {
+	imageRegistryConfig := pb.ImageRegistryConfig_builder{
+		RegistryAuthType: pb.RegistryAuthType_REGISTRY_AUTH_TYPE_AWS,
+		SecretId:         secret.SecretId,
+	}.Build()
+	return imageFromRegistryConfig(tag, imageRegistryConfig, nil)
+}
+
+// ImageFromGcpArtifactRegistry returns an Image from a GCP Artifact Registry
+// tag. The Image is built in the App it is first used with in CreateSandbox,
+// or with Image.Build.
+func ImageFromGcpArtifactRegistry(tag string, secret *Secret) *Image {
+	imageRegistryConfig := pb.ImageRegistryConfig_builder{
+		RegistryAuthType: pb.RegistryAuthType_REGISTRY_AUTH_TYPE_GCP,
+		SecretId:         secret.SecretId,
+	}.Build()
+	return imageFromRegistryConfig(tag, imageRegistryConfig, nil)
+}
+
+func imageFromRegistryConfig(tag string, imageRegistryConfig *pb.ImageRegistryConfig, options *ImageBuildOptions) *Image {
+	return &Image{
+		layer: &imageLayer{
+			commands:       []string{`FROM ` + tag},
+			registryConfig: imageRegistryConfig,
+		},
+		buildOptions: options,
+	}
+}
+
+// imageBuildLogTailLines is the number of build log lines included in the
+// error of a failed build.
+const imageBuildLogTailLines = 30
+
+// ImageBuildOptions are options for building an Image.
+type ImageBuildOptions struct {
+	Output     io.Writer                // Receives the logs of the build, if set.
+	OnProgress func(ImageBuildProgress) // Called with state changes and progress of the build, if set.
+	ForceBuild bool                     // Build the Image and its base Images again, even if they were built before.
+
+	// Timeout is the maximum time to wait for the build of the Image and its
+	// base Images together (default: no limit).
+	// The build is not cancelled on Modal when the timeout expires, so a
+	// later build with the same definition may pick up where it left off.
+	Timeout time.Duration
 }
 
-func fromRegistryInternal(app *App, tag string, imageRegistryConfig *pb.ImageRegistryConfig) (*Image, error) {
+// ImageBuildProgress is a progress update of an Image build.
+type ImageBuildProgress struct {
+	State       string // State of the build task, e.g. "queued" or "active", if it changed.
+	Description string // Description of the step in progress, if any.
+	Pos         uint64 // Progress of the step, out of Len.
+	Len         uint64
+}
+
+// withBuildTimeout applies the build timeout of options to ctx, if any.
+func withBuildTimeout(ctx context.Context, options *ImageBuildOptions) (context.Context, context.CancelFunc) {
+	if options == nil || options.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, options.Timeout)
+}
+
+// imageGetOrCreate builds an Image from its definition, or returns the ID of
+// an existing Image with the same definition. The build timeout of options
+// must already be applied to ctx with withBuildTimeout.
+func imageGetOrCreate(ctx context.Context, appId string, image *pb.Image, options *ImageBuildOptions) (string, *ImageMetadata, error) {
+	if options == nil {
+		options = &ImageBuildOptions{}
+	}
+
 	resp, err := client.ImageGetOrCreate(
-		app.ctx,
+		ctx,
 		pb.ImageGetOrCreateRequest_builder{
-			AppId: app.AppId,
-			Image: pb.Image_builder{
-				DockerfileCommands:  []string{`FROM ` + tag},
-				ImageRegistryConfig: imageRegistryConfig,
-			}.Build(),
+			AppId:          appId,
+			Image:          image,
 			BuilderVersion: imageBuilderVersion(""),
+			ForceBuild:     options.ForceBuild,
 		}.Build(),
 	)
 	if err != nil {
-		return nil, err
+		return "", nil, imageBuildError(ctx, "", options, err)
 	}
 
 	result := resp.GetResult()
@@ -41,14 +185,15 @@ func fromRegistryInternal(app *App, tag string, imageRegistryConfig *pb.ImageReg
 	} else {
 		// Not built or in the process of building - wait for build
 		lastEntryId := ""
+		logs := &imageBuildLog{output: options.Output, onProgress: options.OnProgress}
 		for result == nil {
-			stream, err := client.ImageJoinStreaming(app.ctx, pb.ImageJoinStreamingRequest_builder{
+			stream, err := client.ImageJoinStreaming(ctx, pb.ImageJoinStreamingRequest_builder{
 				ImageId:     resp.GetImageId(),
 				Timeout:     55,
 				LastEntryId: lastEntryId,
 			}.Build())
 			if err != nil {
-				return nil, err
+				return "", nil, imageBuildError(ctx, resp.GetImageId(), options, err)
 			}
 			for {
 				item, err := stream.Recv()
@@ -56,39 +201,108 @@ func fromRegistryInternal(app *App, tag string, imageRegistryConfig *pb.ImageReg
 					if err == io.EOF {
 						break
 					}
-					return nil, err
+					return "", nil, imageBuildError(ctx, resp.GetImageId(), options, err)
 				}
 				if item.GetEntryId() != "" {
 					lastEntryId = item.GetEntryId()
 				}
+				for _, taskLog := range item.GetTaskLogs() {
+					logs.handle(taskLog)
+				}
 				if item.GetResult() != nil && item.GetResult().GetStatus() != pb.GenericResult_GENERIC_STATUS_UNSPECIFIED {
 					result = item.GetResult()
 					metadata = item.GetMetadata()
 					break
 				}
-				// Ignore all log lines and progress updates.
+			}
+		}
+		if result.GetStatus() == pb.GenericResult_GENERIC_STATUS_FAILURE {
+			if tail := logs.tail(); tail != "" {
+				return "", nil, RemoteError{fmt.Sprintf("Image build for %s failed with the exception:\n%s\n\nLast lines of the build log:\n%s", resp.GetImageId(), result.GetException(), tail)}
 			}
 		}
 	}
 
-	_ = metadata
-
 	switch result.GetStatus() {
 	case pb.GenericResult_GENERIC_STATUS_FAILURE:
-		return nil, RemoteError{fmt.Sprintf("Image build for %s failed with the exception:\n%s", resp.GetImageId(), result.GetException())}
+		return "", nil, RemoteError{fmt.Sprintf("Image build for %s failed with the exception:\n%s", resp.GetImageId(), result.GetException())}
 	case pb.GenericResult_GENERIC_STATUS_TERMINATED:
-		return nil, RemoteError{fmt.Sprintf("Image build for %s terminated due to external shut-down, please try again", resp.GetImageId())}
+		return "", nil, RemoteError{fmt.Sprintf("Image build for %s terminated due to external shut-down, please try again", resp.GetImageId())}
 	case pb.GenericResult_GENERIC_STATUS_TIMEOUT:
-		return nil, RemoteError{fmt.Sprintf("Image build for %s timed out, please try again with a larger timeout parameter", resp.GetImageId())}
+		return "", nil, ImageBuildTimeoutError{fmt.Sprintf("Image build for %s timed out on Modal, please try again", resp.GetImageId())}
 	case pb.GenericResult_GENERIC_STATUS_SUCCESS:
 		// Success, do nothing
 	default:
-		return nil, RemoteError{fmt.Sprintf("Image build for %s failed with unknown status: %s", resp.GetImageId(), result.GetStatus())}
+		return "", nil, RemoteError{fmt.Sprintf("Image build for %s failed with unknown status: %s", resp.GetImageId(), result.GetStatus())}
+	}
+
+	return resp.GetImageId(), imageMetadataFromProto(metadata), nil
+}
+
+// imageBuildError returns ImageBuildTimeoutError if err was caused by the
+// build timeout, or err otherwise.
+func imageBuildError(ctx context.Context, imageId string, options *ImageBuildOptions, err error) error {
+	if options.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if imageId == "" {
+			return ImageBuildTimeoutError{fmt.Sprintf("Image build did not finish within %s", options.Timeout)}
+		}
+		return ImageBuildTimeoutError{fmt.Sprintf("Image build for %s did not finish within %s", imageId, options.Timeout)}
+	}
+	return err
+}
+
+// imageBuildLog forwards the logs and progress of an Image build, and keeps
+// the last lines of the logs.
+type imageBuildLog struct {
+	output     io.Writer
+	onProgress func(ImageBuildProgress)
+
+	lines   []string // last complete lines
+	partial string   // incomplete last line
+	state   pb.TaskState
+}
+
+func (l *imageBuildLog) handle(taskLog *pb.TaskLogs) {
+	if data := taskLog.GetData(); data != "" {
+		if l.output != nil {
+			// Build logs are best-effort, so failed writes don't fail the build.
+			_, _ = io.WriteString(l.output, data)
+		}
+		l.record(data)
 	}
+	if l.onProgress == nil {
+		return
+	}
+	if state := taskLog.GetTaskState(); state != pb.TaskState_TASK_STATE_UNSPECIFIED && state != l.state {
+		l.state = state
+		l.onProgress(ImageBuildProgress{State: strings.ToLower(strings.TrimPrefix(state.String(), "TASK_STATE_"))})
+	}
+	if progress := taskLog.GetTaskProgress(); progress != nil {
+		l.onProgress(ImageBuildProgress{
+			Description: progress.GetDescription(),
+			Pos:         progress.GetPos(),
+			Len:         progress.GetLen(),
+		})
+	}
+}
 
-	img := &Image{
-		ImageId: resp.GetImageId(),
-		ctx:     app.ctx,
+func (l *imageBuildLog) record(data string) {
+	lines := strings.Split(l.partial+data, "\n")
+	l.partial = lines[len(lines)-1]
+	l.lines = append(l.lines, lines[:len(lines)-1]...)
+	if n := len(l.lines); n > imageBuildLogTailLines {
+		l.lines = append(l.lines[:0], l.lines[n-imageBuildLogTailLines:]...)
+	}
+}
+
+// tail returns the last lines of the logs.
+func (l *imageBuildLog) tail() string {
+	lines := l.lines
+	if l.partial != "" {
+		lines = append(lines, l.partial)
+	}
+	if n := len(lines); n > imageBuildLogTailLines {
+		lines = lines[n-imageBuildLogTailLines:]
 	}
-	return img, nil
+	return strings.Join(lines, "\n")
 }
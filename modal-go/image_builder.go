@@ -0,0 +1,290 @@
+package modal
+
+// image_builder.go implements layered Images, which are defined by adding
+// Dockerfile commands on top of another Image and built on first use.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// imageCache maps App IDs and Image definitions to built Images, so that
+// identical definitions are only built once per process.
+var imageCache sync.Map // string -> cachedImage
+
+type cachedImage struct {
+	imageId  string
+	metadata *ImageMetadata
+}
+
+// ImageDockerfileCommandsOptions are options for Image.DockerfileCommands.
+type ImageDockerfileCommandsOptions struct {
+	Secrets []*Secret // Secrets available as environment variables to RUN commands.
+	GPU     string    // GPU to build the layer on, e.g. "T4" or "A100:2".
+	Context *Mount    // Files available to COPY and ADD commands.
+}
+
+// imageLayer is the definition of an Image, usually on top of a base Image.
+type imageLayer struct {
+	commands       []string
+	options        ImageDockerfileCommandsOptions
+	registryConfig *pb.ImageRegistryConfig // for pulling private registry images
+	dockerfile     *dockerfileSource       // replaces the other fields for Dockerfile Images
+}
+
+// DockerfileCommands returns a new Image that runs Dockerfile commands, such
+// as "RUN", "ENV", or "COPY", on top of this Image.
+//
+// The Image is built when it is first used to create a Sandbox. Images with
+// identical definitions are only built once per App.
+func (img *Image) DockerfileCommands(commands []string, options *ImageDockerfileCommandsOptions) *Image {
+	if options == nil {
+		options = &ImageDockerfileCommandsOptions{}
+	}
+	return &Image{
+		ctx:   img.ctx,
+		base:  img,
+		layer: &imageLayer{commands: append([]string{}, commands...), options: *options},
+	}
+}
+
+// AptInstall returns a new Image with Debian packages installed using apt-get.
+func (img *Image) AptInstall(packages ...string) *Image {
+	return img.DockerfileCommands([]string{
+		"RUN apt-get update",
+		"RUN DEBIAN_FRONTEND=noninteractive apt-get install -y " + shellJoin(packages),
+	}, nil)
+}
+
+// PipInstall returns a new Image with Python packages installed using pip.
+func (img *Image) PipInstall(packages ...string) *Image {
+	return img.DockerfileCommands([]string{
+		"RUN python -m pip install " + shellJoin(packages),
+	}, nil)
+}
+
+// Env returns a new Image with environment variables set.
+func (img *Image) Env(vars map[string]string) *Image {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	commands := make([]string, len(names))
+	for i, name := range names {
+		commands[i] = fmt.Sprintf("ENV %s=%s", name, shellQuote(vars[name]))
+	}
+	return img.DockerfileCommands(commands, nil)
+}
+
+// Workdir returns a new Image with the working directory set.
+func (img *Image) Workdir(path string) *Image {
+	return img.DockerfileCommands([]string{"WORKDIR " + dockerfileEscape(path)}, nil)
+}
+
+// RunCommands returns a new Image that runs shell commands.
+func (img *Image) RunCommands(commands ...string) *Image {
+	run := make([]string, len(commands))
+	for i, command := range commands {
+		run[i] = "RUN " + command
+	}
+	return img.DockerfileCommands(run, nil)
+}
+
+// Build builds the Image and its base Images in the App, unless they were
+// built before. Images are also built when they are first used in
+// CreateSandbox, so this is only needed to control how they are built.
+func (img *Image) Build(app *App, options *ImageBuildOptions) error {
+	return img.build(app.ctx, app, options)
+}
+
+// build builds the Image with ctx, in an App.
+func (img *Image) build(ctx context.Context, app *App, options *ImageBuildOptions) error {
+	if options != nil && options.ForceBuild && img.layer == nil {
+		return InvalidError{Exception: fmt.Sprintf("Image %s has no definition, so it can't be rebuilt", img.ImageId)}
+	}
+	// The timeout applies to the builds of all layers together.
+	ctx, cancel := withBuildTimeout(ctx, options)
+	defer cancel()
+	return img.buildLayers(ctx, app, options, options != nil && options.Timeout > 0)
+}
+
+// buildLayers builds the base Images of the Image, and then the Image. If
+// timed is false, the build timeout of each layer is applied to its build.
+func (img *Image) buildLayers(ctx context.Context, app *App, options *ImageBuildOptions, timed bool) error {
+	img.mu.Lock()
+	defer img.mu.Unlock()
+	forced := options != nil && options.ForceBuild
+	if img.ImageId != "" && (!forced || img.layer == nil) {
+		return nil
+	}
+	if img.layer == nil {
+		return InvalidError{Exception: "Image has no ID and no definition"}
+	}
+
+	baseImageId := ""
+	if img.base != nil {
+		if err := img.base.buildLayers(ctx, app, options, timed); err != nil {
+			return err
+		}
+		baseImageId = img.base.ImageId
+	}
+	if options == nil {
+		options = img.buildOptions
+	}
+	if !timed {
+		var cancel context.CancelFunc
+		ctx, cancel = withBuildTimeout(ctx, options)
+		defer cancel()
+	}
+	var definition *pb.Image
+	var err error
+	if img.layer.dockerfile != nil {
+		definition, err = img.layer.dockerfile.definition(ctx)
+	} else {
+		definition, err = img.layer.definition(baseImageId)
+	}
+	if err != nil {
+		return err
+	}
+	imageId, metadata, err := cachedImageGetOrCreate(ctx, app.AppId, definition, options)
+	if err != nil {
+		return err
+	}
+	img.ImageId = imageId
+	img.Metadata = metadata
+	img.ctx = app.ctx
+	return nil
+}
+
+// definition returns the Image definition of the layer on top of a base
+// Image, or of the layer alone if baseImageId is empty.
+func (l *imageLayer) definition(baseImageId string) (*pb.Image, error) {
+	gpuConfig, err := parseGPUConfig(l.options.GPU)
+	if err != nil {
+		return nil, err
+	}
+	secretIds := []string{}
+	for _, secret := range l.options.Secrets {
+		if secret != nil {
+			secretIds = append(secretIds, secret.SecretId)
+		}
+	}
+	contextMountId := ""
+	if l.options.Context != nil {
+		contextMountId = l.options.Context.MountId
+	}
+
+	var baseImages []*pb.BaseImage
+	commands := l.commands
+	if baseImageId != "" {
+		baseImages = []*pb.BaseImage{pb.BaseImage_builder{
+			DockerTag: "base",
+			ImageId:   baseImageId,
+		}.Build()}
+		commands = append([]string{"FROM base"}, l.commands...)
+	}
+
+	return pb.Image_builder{
+		BaseImages:          baseImages,
+		DockerfileCommands:  commands,
+		SecretIds:           secretIds,
+		GpuConfig:           gpuConfig,
+		ContextMountId:      contextMountId,
+		ImageRegistryConfig: l.registryConfig,
+	}.Build(), nil
+}
+
+// cachedImageGetOrCreate is imageGetOrCreate, returning the Image built
+// before in this process for the same App and definition if any, unless a
+// build is forced.
+func cachedImageGetOrCreate(ctx context.Context, appId string, image *pb.Image, options *ImageBuildOptions) (string, *ImageMetadata, error) {
+	key, err := imageCacheKey(appId, image)
+	if err != nil {
+		return "", nil, err
+	}
+	if options == nil || !options.ForceBuild {
+		if cached, ok := imageCache.Load(key); ok {
+			return cached.(cachedImage).imageId, cached.(cachedImage).metadata, nil
+		}
+	}
+	imageId, metadata, err := imageGetOrCreate(ctx, appId, image, options)
+	if err != nil {
+		return "", nil, err
+	}
+	imageCache.Store(key, cachedImage{imageId: imageId, metadata: metadata})
+	return imageId, metadata, nil
+}
+
+func imageCacheKey(appId string, image *pb.Image) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(image)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return appId + "/" + hex.EncodeToString(sum[:]), nil
+}
+
+// parseGPUConfig parses a GPU specification such as "T4", "a100-80gb", or
+// "H100:8". An empty string means no GPU.
+func parseGPUConfig(gpu string) (*pb.GPUConfig, error) {
+	if gpu == "" {
+		return nil, nil
+	}
+	gpuType, countStr, hasCount := strings.Cut(gpu, ":")
+	count := 1
+	if hasCount {
+		var err error
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count < 1 {
+			return nil, InvalidError{Exception: fmt.Sprintf("invalid GPU count %q in %q", countStr, gpu)}
+		}
+	}
+	return pb.GPUConfig_builder{
+		GpuType: strings.ToUpper(gpuType),
+		Count:   uint32(count),
+	}.Build(), nil
+}
+
+// shellQuote quotes a string for a POSIX shell, if needed.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("@%+=:,./-_", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// dockerfileEscape escapes a string for instructions like WORKDIR, which
+// take the rest of the line as is, except for variables and escapes.
+func dockerfileEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "$", `\$`).Replace(s)
+}
+
+// shellJoin quotes and joins words for a POSIX shell.
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellQuote(w)
+	}
+	return strings.Join(quoted, " ")
+}
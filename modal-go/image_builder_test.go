@@ -0,0 +1,125 @@
+package modal
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestImageLayers(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	base := &Image{ImageId: "im-base"}
+	img := base.
+		AptInstall("git", "curl").
+		PipInstall("numpy==2.2.0", "requests>=2").
+		Env(map[string]string{"B": "two words", "A": "1"}).
+		Workdir("/app").
+		RunCommands("echo hi > /tmp/out")
+
+	var commands []string
+	for layer := img; layer.layer != nil; layer = layer.base {
+		commands = append(append([]string{}, layer.layer.commands...), commands...)
+	}
+	g.Expect(commands).Should(gomega.Equal([]string{
+		"RUN apt-get update",
+		"RUN DEBIAN_FRONTEND=noninteractive apt-get install -y git curl",
+		"RUN python -m pip install numpy==2.2.0 'requests>=2'",
+		"ENV A=1",
+		"ENV B='two words'",
+		"WORKDIR /app",
+		"RUN echo hi > /tmp/out",
+	}))
+	g.Expect(img.ImageId).Should(gomega.BeEmpty())
+	g.Expect(base.ImageId).Should(gomega.Equal("im-base"))
+
+	definition, err := img.layer.definition("im-parent")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(definition.GetBaseImages()).Should(gomega.HaveLen(1))
+	g.Expect(definition.GetBaseImages()[0].GetImageId()).Should(gomega.Equal("im-parent"))
+	g.Expect(definition.GetBaseImages()[0].GetDockerTag()).Should(gomega.Equal("base"))
+	g.Expect(definition.GetDockerfileCommands()).Should(gomega.Equal([]string{"FROM base", "RUN echo hi > /tmp/out"}))
+}
+
+func TestImageCacheKey(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	base := &Image{ImageId: "im-base"}
+	definition := func(img *Image) string {
+		d, err := img.layer.definition(img.base.ImageId)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		key, err := imageCacheKey("ap-123", d)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return key
+	}
+
+	a := definition(base.PipInstall("numpy"))
+	g.Expect(definition(base.PipInstall("numpy"))).Should(gomega.Equal(a))
+	g.Expect(definition(base.PipInstall("scipy"))).ShouldNot(gomega.Equal(a))
+	g.Expect(definition((&Image{ImageId: "im-other"}).PipInstall("numpy"))).ShouldNot(gomega.Equal(a))
+}
+
+func TestParseGPUConfig(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	config, err := parseGPUConfig("")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(config).Should(gomega.BeNil())
+
+	config, err = parseGPUConfig("a100-80gb")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(config.GetGpuType()).Should(gomega.Equal("A100-80GB"))
+	g.Expect(config.GetCount()).Should(gomega.Equal(uint32(1)))
+
+	config, err = parseGPUConfig("H100:8")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(config.GetGpuType()).Should(gomega.Equal("H100"))
+	g.Expect(config.GetCount()).Should(gomega.Equal(uint32(8)))
+
+	_, err = parseGPUConfig("T4:zero")
+	g.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestImageFromRegistryLazy(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	image := ImageFromRegistry("python:3.13-slim", &ImageFromRegistryOptions{
+		Secret: &Secret{SecretId: "st-123"},
+	})
+	g.Expect(image.ImageId).Should(gomega.BeEmpty())
+
+	definition, err := image.layer.definition("")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(definition.GetBaseImages()).Should(gomega.BeEmpty())
+	g.Expect(definition.GetDockerfileCommands()).Should(gomega.Equal([]string{"FROM python:3.13-slim"}))
+	g.Expect(definition.GetImageRegistryConfig().GetSecretId()).Should(gomega.Equal("st-123"))
+
+	// Layers on top of a lazy Image are lazy too.
+	layered := image.PipInstall("numpy")
+	g.Expect(layered.base).Should(gomega.BeIdenticalTo(image))
+	g.Expect(layered.ImageId).Should(gomega.BeEmpty())
+}
+
+func TestImageWorkdir(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	base := &Image{ImageId: "im-base"}
+	g.Expect(base.Workdir("/my app").layer.commands).Should(gomega.Equal([]string{"WORKDIR /my app"}))
+	g.Expect(base.Workdir(`/it's $HOME\x`).layer.commands).Should(gomega.Equal([]string{`WORKDIR /it's \$HOME\\x`}))
+}
+
+func TestImageForceBuildWithoutDefinition(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	// Images looked up by ID can't be rebuilt, as their definition is unknown.
+	img := &Image{ImageId: "im-123"}
+	err := img.Build(&App{}, &ImageBuildOptions{ForceBuild: true})
+	g.Expect(err).Should(gomega.BeAssignableToTypeOf(InvalidError{}))
+	g.Expect(img.Build(&App{}, nil)).Should(gomega.Succeed())
+}
@@ -0,0 +1,225 @@
+package modal
+
+// image_dockerfile.go builds Images from local Dockerfiles.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+)
+
+// DockerfileOptions are options for building an Image from a Dockerfile.
+type DockerfileOptions struct {
+	Context   string             // Build context directory (default: the directory of the Dockerfile).
+	BuildArgs map[string]string  // Values of ARG instructions.
+	Secrets   []*Secret          // Secrets available as environment variables to RUN instructions.
+	GPU       string             // GPU to build the Image on, e.g. "T4" or "A100:2".
+	Build     *ImageBuildOptions // Options for building the Image.
+}
+
+// ImageFromDockerfile returns an Image from a local Dockerfile. The Image is
+// built in the App it is first used with in CreateSandbox, or with
+// Image.Build, and the Dockerfile is read at that time.
+//
+// Files of the build context that are referenced by COPY and ADD
+// instructions are uploaded for the build, except for files excluded by a
+// .dockerignore file in the context directory.
+func ImageFromDockerfile(path string, options *DockerfileOptions) *Image {
+	if options == nil {
+		options = &DockerfileOptions{}
+	}
+	return &Image{
+		layer:        &imageLayer{dockerfile: &dockerfileSource{path: path, options: *options}},
+		buildOptions: options.Build,
+	}
+}
+
+// ImageFromDockerfile builds an Image from a local Dockerfile in the App.
+func (app *App) ImageFromDockerfile(path string, options *DockerfileOptions) (*Image, error) {
+	return app.buildImage(ImageFromDockerfile(path, options))
+}
+
+// dockerfileSource is the definition of an Image built from a local Dockerfile.
+type dockerfileSource struct {
+	path    string
+	options DockerfileOptions
+}
+
+// definition reads the Dockerfile and uploads the files of its build context,
+// and returns the Image definition.
+func (d *dockerfileSource) definition(ctx context.Context) (*pb.Image, error) {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	contextDir := d.options.Context
+	if contextDir == "" {
+		contextDir = filepath.Dir(d.path)
+	}
+
+	commands, sources := parseDockerfile(string(data), d.options.BuildArgs)
+	var contextMountId string
+	if len(sources) > 0 {
+		mount, err := dockerContextMount(ctx, d.path, contextDir, sources)
+		if err != nil {
+			return nil, err
+		}
+		contextMountId = mount.MountId
+	}
+
+	gpuConfig, err := parseGPUConfig(d.options.GPU)
+	if err != nil {
+		return nil, err
+	}
+	secretIds := []string{}
+	for _, secret := range d.options.Secrets {
+		if secret != nil {
+			secretIds = append(secretIds, secret.SecretId)
+		}
+	}
+	return pb.Image_builder{
+		DockerfileCommands: commands,
+		ContextMountId:     contextMountId,
+		BuildArgs:          d.options.BuildArgs,
+		SecretIds:          secretIds,
+		GpuConfig:          gpuConfig,
+	}.Build(), nil
+}
+
+// dockerContextMount uploads the files of the build context that match the
+// sources of COPY and ADD instructions.
+func dockerContextMount(ctx context.Context, dockerfilePath, contextDir string, sources []string) (*Mount, error) {
+	ignorePatterns, err := readDockerignore(dockerfilePath, contextDir)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := newFilePatternMatcher(ignorePatterns)
+	if err != nil {
+		return nil, err
+	}
+	include, err := newFilePatternMatcher(sources)
+	if err != nil {
+		return nil, err
+	}
+	files, err := listMountFiles(contextDir, "/", ignore, include)
+	if err != nil {
+		return nil, err
+	}
+	return createMount(ctx, files, "")
+}
+
+// readDockerignore reads the ignore patterns for a build, from either
+// "<Dockerfile>.dockerignore" or ".dockerignore" in the context directory,
+// like Docker does.
+func readDockerignore(dockerfilePath, contextDir string) ([]string, error) {
+	for _, name := range []string{dockerfilePath + ".dockerignore", filepath.Join(contextDir, ".dockerignore")} {
+		data, err := os.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var patterns []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				patterns = append(patterns, line)
+			}
+		}
+		return patterns, nil
+	}
+	return nil, nil
+}
+
+// parseDockerfile returns the lines of a Dockerfile, and the sources of its
+// COPY and ADD instructions that refer to the build context. Variables in
+// sources are expanded with buildArgs and the defaults of ARG instructions.
+func parseDockerfile(dockerfile string, buildArgs map[string]string) (commands, sources []string) {
+	commands = strings.Split(strings.ReplaceAll(dockerfile, "\r\n", "\n"), "\n")
+
+	args := map[string]string{}
+	for _, instruction := range dockerfileInstructions(commands) {
+		keyword, rest, _ := strings.Cut(instruction, " ")
+		rest = strings.TrimSpace(rest)
+		switch strings.ToUpper(keyword) {
+		case "ARG":
+			name, value, _ := strings.Cut(rest, "=")
+			if v, ok := buildArgs[name]; ok {
+				value = v
+			}
+			args[name] = strings.Trim(value, `"'`)
+		case "COPY", "ADD":
+			for _, source := range copySources(rest) {
+				sources = append(sources, os.Expand(source, func(name string) string { return args[name] }))
+			}
+		}
+	}
+	return commands, sources
+}
+
+// dockerfileInstructions joins continuation lines and drops comments.
+func dockerfileInstructions(lines []string) []string {
+	var instructions []string
+	var current strings.Builder
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasSuffix(trimmed, `\`) {
+			current.WriteString(strings.TrimSuffix(trimmed, `\`) + " ")
+			continue
+		}
+		current.WriteString(trimmed)
+		if instruction := strings.TrimSpace(current.String()); instruction != "" {
+			instructions = append(instructions, instruction)
+		}
+		current.Reset()
+	}
+	return instructions
+}
+
+// copySources returns the local sources of a COPY or ADD instruction, given
+// its arguments. Copies from other build stages, URLs and heredocs have no
+// local sources.
+func copySources(args string) []string {
+	var words []string
+	for {
+		args = strings.TrimSpace(args)
+		if !strings.HasPrefix(args, "--") {
+			break
+		}
+		flag, rest, _ := strings.Cut(args, " ")
+		if strings.HasPrefix(flag, "--from=") {
+			return nil
+		}
+		args = rest
+	}
+
+	if strings.HasPrefix(args, "[") {
+		if err := json.Unmarshal([]byte(args), &words); err != nil {
+			return nil
+		}
+	} else {
+		words = strings.Fields(args)
+	}
+	if len(words) < 2 {
+		return nil
+	}
+
+	var sources []string
+	for _, word := range words[:len(words)-1] {
+		if strings.HasPrefix(word, "<<") || strings.Contains(word, "://") || strings.HasPrefix(word, "git@") {
+			continue
+		}
+		sources = append(sources, word)
+	}
+	return sources
+}
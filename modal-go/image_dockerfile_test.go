@@ -0,0 +1,94 @@
+package modal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dockerfile := `FROM python:3.13-slim AS base
+ARG APP_DIR=src
+# COPY commented/out .
+COPY requirements.txt /tmp/
+RUN pip install -r /tmp/requirements.txt
+COPY --chown=1000:1000 ${APP_DIR} \
+    config/*.toml /app/
+ADD ["data file.csv", "/data/"]
+ADD https://example.com/archive.tar.gz /tmp/
+COPY --from=base /usr/bin/python /usr/bin/python
+`
+	commands, sources := parseDockerfile(dockerfile, map[string]string{"APP_DIR": "app"})
+	g.Expect(commands[0]).Should(gomega.Equal("FROM python:3.13-slim AS base"))
+	g.Expect(commands).Should(gomega.HaveLen(11))
+	g.Expect(sources).Should(gomega.Equal([]string{"requirements.txt", "app", "config/*.toml", "data file.csv"}))
+
+	_, sources = parseDockerfile("FROM alpine\nARG DIR=\"src\"\nCOPY $DIR /src", nil)
+	g.Expect(sources).Should(gomega.Equal([]string{"src"}))
+}
+
+func TestDockerContextFiles(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Dockerfile":          "FROM alpine\nCOPY . /app",
+		".dockerignore":       "# build outputs\n*.log\n.git\n",
+		"main.py":             "print('hi')",
+		"debug.log":           "log",
+		".git/HEAD":           "ref: refs/heads/main",
+		"pkg/util.py":         "",
+		"Dockerfile.unused":   "",
+		"pkg/nested/data.log": "log",
+	} {
+		p := filepath.Join(dir, name)
+		g.Expect(os.MkdirAll(filepath.Dir(p), 0o755)).Should(gomega.Succeed())
+		g.Expect(os.WriteFile(p, []byte(content), 0o644)).Should(gomega.Succeed())
+	}
+
+	patterns, err := readDockerignore(filepath.Join(dir, "Dockerfile"), dir)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(patterns).Should(gomega.Equal([]string{"*.log", ".git"}))
+
+	ignore, err := newFilePatternMatcher(patterns)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	include, err := newFilePatternMatcher([]string{"."})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	files, err := listMountFiles(dir, "/", ignore, include)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.remotePath)
+	}
+	g.Expect(names).Should(gomega.Equal([]string{
+		"/.dockerignore", "/Dockerfile", "/Dockerfile.unused", "/main.py", "/pkg/nested/data.log", "/pkg/util.py",
+	}))
+
+	include, err = newFilePatternMatcher([]string{"pkg"})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	files, err = listMountFiles(dir, "/", ignore, include)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(files).Should(gomega.HaveLen(2))
+}
+
+func TestImageFromDockerfileLazy(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	// The Dockerfile is only read when the Image is built.
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	image := ImageFromDockerfile(path, nil)
+	g.Expect(image.ImageId).Should(gomega.BeEmpty())
+
+	err := image.Build(&App{ctx: context.Background()}, nil)
+	g.Expect(err).Should(gomega.MatchError(os.ErrNotExist))
+	g.Expect(image.ImageId).Should(gomega.BeEmpty())
+}
@@ -0,0 +1,87 @@
+package modal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"github.com/onsi/gomega"
+)
+
+func TestImageBuildLog(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	var output strings.Builder
+	var progress []ImageBuildProgress
+	logs := &imageBuildLog{
+		output:     &output,
+		onProgress: func(p ImageBuildProgress) { progress = append(progress, p) },
+	}
+
+	logs.handle(pb.TaskLogs_builder{TaskState: pb.TaskState_TASK_STATE_QUEUED}.Build())
+	logs.handle(pb.TaskLogs_builder{TaskState: pb.TaskState_TASK_STATE_QUEUED}.Build())
+	logs.handle(pb.TaskLogs_builder{TaskState: pb.TaskState_TASK_STATE_ACTIVE, Data: "Step 1/2\nStep "}.Build())
+	logs.handle(pb.TaskLogs_builder{Data: "2/2\n"}.Build())
+	logs.handle(pb.TaskLogs_builder{TaskProgress: pb.TaskProgress_builder{
+		Description: "Uploading", Pos: 5, Len: 10,
+	}.Build()}.Build())
+
+	g.Expect(output.String()).Should(gomega.Equal("Step 1/2\nStep 2/2\n"))
+	g.Expect(logs.tail()).Should(gomega.Equal("Step 1/2\nStep 2/2"))
+	g.Expect(progress).Should(gomega.Equal([]ImageBuildProgress{
+		{State: "queued"},
+		{State: "active"},
+		{Description: "Uploading", Pos: 5, Len: 10},
+	}))
+
+	// Only the last lines are kept, including an incomplete last line.
+	for i := range 100 {
+		logs.handle(pb.TaskLogs_builder{Data: fmt.Sprintf("line %d\n", i)}.Build())
+	}
+	logs.handle(pb.TaskLogs_builder{Data: "error: no such package"}.Build())
+	lines := strings.Split(logs.tail(), "\n")
+	g.Expect(lines).Should(gomega.HaveLen(imageBuildLogTailLines))
+	g.Expect(lines[0]).Should(gomega.Equal(fmt.Sprintf("line %d", 101-imageBuildLogTailLines)))
+	g.Expect(lines[len(lines)-1]).Should(gomega.Equal("error: no such package"))
+}
+
+func TestImageMetadataFromProto(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	g.Expect(imageMetadataFromProto(nil)).Should(gomega.BeNil())
+
+	pythonVersion := "Python 3.13.2"
+	metadata := imageMetadataFromProto(pb.ImageMetadata_builder{
+		PythonVersionInfo: &pythonVersion,
+		PythonPackages:    map[string]string{"numpy": "2.2.0"},
+	}.Build())
+	g.Expect(metadata.PythonVersion).Should(gomega.Equal("Python 3.13.2"))
+	g.Expect(metadata.PythonPackages).Should(gomega.HaveKeyWithValue("numpy", "2.2.0"))
+	g.Expect(metadata.Workdir).Should(gomega.BeEmpty())
+}
+
+func TestImageBuildError(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	other := errors.New("connection reset")
+	g.Expect(imageBuildError(context.Background(), "im-123", &ImageBuildOptions{}, other)).Should(gomega.Equal(other))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	err := imageBuildError(ctx, "im-123", &ImageBuildOptions{Timeout: time.Minute}, ctx.Err())
+	var timeoutErr ImageBuildTimeoutError
+	g.Expect(errors.As(err, &timeoutErr)).Should(gomega.BeTrue())
+	g.Expect(err.Error()).Should(gomega.ContainSubstring("im-123"))
+
+	// Cancellation by the caller is not a build timeout.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	g.Expect(imageBuildError(ctx, "im-123", &ImageBuildOptions{Timeout: time.Minute}, ctx.Err())).Should(gomega.Equal(context.Canceled))
+}
@@ -0,0 +1,341 @@
+package modal
+
+// lock.go implements distributed locks on top of Dicts.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	lockDefaultTTL         = 30 * time.Second
+	lockInitialBackoff     = 100 * time.Millisecond
+	lockMaxBackoff         = 5 * time.Second
+	lockRenewRetryInterval = time.Second
+)
+
+// LockOptions are options for NewLock.
+type LockOptions struct {
+	TTL time.Duration // Time a lease stays valid without renewal (default 30s).
+
+	// RenewInterval is how often leases are renewed in the background
+	// (default TTL/3). Negative disables renewal, so leases must be renewed
+	// with Lease.Renew.
+	RenewInterval time.Duration
+
+	Holder string // Identifies the holder in the Dict (default: hostname, PID, and a random suffix).
+}
+
+// Lock is a distributed lock stored in a Dict, which can be used by workers
+// to elect a leader.
+//
+// Each acquisition of the lock creates a new entry "<name>:<token>" in the
+// Dict with Dict.Put and SkipIfExists, so exactly one worker gets each token.
+// Tokens increase with each acquisition, and can be passed to other systems
+// as fencing tokens to reject writes of holders that lost their lease. The
+// entry "<name>" holds the latest token, to find it quickly. The entry of a
+// token is removed when its lease is released or taken over, so the Dict only
+// holds the entries of the latest one or two tokens.
+//
+// Leases expire after TTL unless renewed. Expiry is based on the clocks of
+// the workers, which should be synchronized to well within the TTL.
+type Lock struct {
+	dict    lockDict
+	name    string
+	options LockOptions
+}
+
+// Lease is a held Lock, valid until it is released, or expires because it
+// was not renewed in time.
+type Lease struct {
+	Token int64 // Fencing token, which increases with each acquisition of the lock.
+
+	lock *Lock
+
+	mu        sync.Mutex
+	expiresAt time.Time
+	ended     bool
+	done      chan struct{}
+	stopRenew chan struct{}
+}
+
+// lockRecord is the value of the Dict entry of a lease.
+type lockRecord struct {
+	holder    string
+	expiresAt time.Time
+}
+
+// lockDict are the Dict operations used by Lock.
+type lockDict interface {
+	Get(key any) (any, bool, error)
+	Put(key, value any, options *DictPutOptions) (bool, error)
+	Pop(key any) (any, bool, error)
+	Contains(key any) (bool, error)
+}
+
+// NewLock returns a Lock with a name in a Dict. Locks with the same name in
+// the same Dict exclude each other.
+func NewLock(dict *Dict, name string, options *LockOptions) *Lock {
+	return newLock(dict, name, options)
+}
+
+func newLock(dict lockDict, name string, options *LockOptions) *Lock {
+	if options == nil {
+		options = &LockOptions{}
+	}
+	opts := *options
+	if opts.TTL <= 0 {
+		opts.TTL = lockDefaultTTL
+	}
+	if opts.RenewInterval == 0 {
+		opts.RenewInterval = opts.TTL / 3
+	}
+	if opts.Holder == "" {
+		opts.Holder = defaultLockHolder()
+	}
+	return &Lock{dict: dict, name: name, options: opts}
+}
+
+// TryAcquire acquires the lock if it is free, or returns a nil Lease if it is
+// held by someone else.
+func (l *Lock) TryAcquire() (*Lease, error) {
+	latest, err := l.latestToken()
+	if err != nil {
+		return nil, err
+	}
+
+	for token := max(latest, 1); ; {
+		key := l.tokenKey(token)
+		v, found, err := l.dict.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if !found && token == latest {
+			// The entry of the latest token was created before it was recorded,
+			// so it was removed since, and the token must not be reused.
+			token++
+			continue
+		}
+		if found {
+			record, err := parseLockRecord(v)
+			if err != nil {
+				return nil, fmt.Errorf("lock %s: %w", key, err)
+			}
+			if time.Now().Before(record.expiresAt) {
+				return nil, nil // held
+			}
+			token++
+			continue
+		}
+
+		expiresAt := time.Now().Add(l.options.TTL)
+		created, err := l.dict.Put(key, lockRecord{holder: l.options.Holder, expiresAt: expiresAt}.value(), &DictPutOptions{SkipIfExists: true})
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			continue // someone else got this token, check whether it is held
+		}
+		if err := l.recordToken(token); err != nil {
+			return nil, err
+		}
+		// The previous lease expired or was released, so its entry can go.
+		if token > 1 {
+			if _, _, err := l.dict.Pop(l.tokenKey(token - 1)); err != nil {
+				return nil, err
+			}
+		}
+		return l.newLease(token, expiresAt), nil
+	}
+}
+
+// latestToken returns the latest recorded token, or 0 if there is none.
+func (l *Lock) latestToken() (int64, error) {
+	v, found, err := l.dict.Get(l.name)
+	if err != nil || !found {
+		return 0, err
+	}
+	latest, _ := v.(int64)
+	return latest, nil
+}
+
+// recordToken records an acquired token as the latest, unless a later one
+// was recorded already.
+func (l *Lock) recordToken(token int64) error {
+	latest, err := l.latestToken()
+	if err != nil || latest >= token {
+		return err
+	}
+	_, err = l.dict.Put(l.name, token, nil)
+	return err
+}
+
+// Acquire waits until the lock is acquired, or ctx is done.
+func (l *Lock) Acquire(ctx context.Context) (*Lease, error) {
+	backoff := lockInitialBackoff
+	for {
+		lease, err := l.TryAcquire()
+		if err != nil || lease != nil {
+			return lease, err
+		}
+		if err := sleepCtx(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff = min(backoff*2, lockMaxBackoff)
+	}
+}
+
+func (l *Lock) tokenKey(token int64) string {
+	return fmt.Sprintf("%s:%d", l.name, token)
+}
+
+func (l *Lock) newLease(token int64, expiresAt time.Time) *Lease {
+	lease := &Lease{
+		Token:     token,
+		lock:      l,
+		expiresAt: expiresAt,
+		done:      make(chan struct{}),
+		stopRenew: make(chan struct{}),
+	}
+	if l.options.RenewInterval > 0 {
+		go lease.renewLoop()
+	}
+	return lease
+}
+
+// Renew extends the lease by the TTL of the lock. It returns an error if the
+// lease has ended, or has expired and was acquired by someone else.
+func (l *Lease) Renew() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ended {
+		return InvalidError{fmt.Sprintf("lease %d of lock %s has ended", l.Token, l.lock.name)}
+	}
+	if !time.Now().Before(l.expiresAt) {
+		l.endLocked()
+		return InvalidError{fmt.Sprintf("lease %d of lock %s expired", l.Token, l.lock.name)}
+	}
+
+	expiresAt := time.Now().Add(l.lock.options.TTL)
+	record := lockRecord{holder: l.lock.options.Holder, expiresAt: expiresAt}
+	key := l.lock.tokenKey(l.Token)
+	if _, err := l.lock.dict.Put(key, record.value(), nil); err != nil {
+		return err
+	}
+	// A newer token means that someone else considered the lease expired.
+	taken, err := l.takenOver()
+	if err != nil {
+		return err
+	}
+	if taken {
+		l.endLocked()
+		// The Put above may have recreated the entry removed by the new holder.
+		_, _, err := l.lock.dict.Pop(key)
+		return errors.Join(InvalidError{fmt.Sprintf("lease %d of lock %s was taken over", l.Token, l.lock.name)}, err)
+	}
+	l.expiresAt = expiresAt
+	return nil
+}
+
+// takenOver returns whether a newer token was acquired, even if its lease was
+// released already.
+func (l *Lease) takenOver() (bool, error) {
+	latest, err := l.lock.latestToken()
+	if err != nil || latest > l.Token {
+		return latest > l.Token, err
+	}
+	return l.lock.dict.Contains(l.lock.tokenKey(l.Token + 1))
+}
+
+func (l *Lease) renewLoop() {
+	interval := l.lock.options.RenewInterval
+	t := time.NewTimer(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stopRenew:
+			return
+		case <-t.C:
+		}
+		if err := l.Renew(); err != nil {
+			if !l.Valid() {
+				return
+			}
+			// Retry transient errors while the lease is still valid.
+			t.Reset(min(interval, lockRenewRetryInterval))
+			continue
+		}
+		t.Reset(interval)
+	}
+}
+
+// Valid reports whether the lease is still held, as far as the holder knows.
+func (l *Lease) Valid() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.ended && time.Now().Before(l.expiresAt)
+}
+
+// Done returns a channel that is closed when the lease ends, because it was
+// released, or was lost because renewal failed. The lease also ends when it
+// expires, which is only noticed by the next renewal.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Release releases the lock, so that others can acquire it immediately.
+// Releasing a lease that has ended is a no-op.
+func (l *Lease) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ended {
+		return nil
+	}
+	l.endLocked()
+	// Tokens are never reused, so the entry can go even if the lease expired
+	// and someone else holds the lock already.
+	_, _, err := l.lock.dict.Pop(l.lock.tokenKey(l.Token))
+	return err
+}
+
+func (l *Lease) endLocked() {
+	l.ended = true
+	close(l.stopRenew)
+	close(l.done)
+}
+
+// value returns the Dict value of the record, which is a Python dict.
+func (r lockRecord) value() map[any]any {
+	return map[any]any{"holder": r.holder, "expires_at": float64(r.expiresAt.UnixNano()) / 1e9}
+}
+
+func parseLockRecord(v any) (lockRecord, error) {
+	m, ok := v.(map[any]any)
+	if !ok {
+		return lockRecord{}, fmt.Errorf("unexpected lock record of type %T", v)
+	}
+	holder, _ := m["holder"].(string)
+	var seconds float64
+	switch e := m["expires_at"].(type) {
+	case float64:
+		seconds = e
+	case int64:
+		seconds = float64(e)
+	default:
+		return lockRecord{}, fmt.Errorf("unexpected expires_at of type %T", e)
+	}
+	return lockRecord{holder: holder, expiresAt: timeFromSeconds(seconds)}, nil
+}
+
+func defaultLockHolder() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,186 @@
+package modal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+)
+
+func TestLockRecord(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	expiresAt := time.Unix(1700000000, 500000000)
+	data, err := pickleSerialize(lockRecord{holder: "worker-1", expiresAt: expiresAt}.value())
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	v, err := pickleDeserialize(data.Bytes())
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	record, err := parseLockRecord(v)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(record.holder).Should(gomega.Equal("worker-1"))
+	g.Expect(record.expiresAt.Sub(expiresAt).Abs()).Should(gomega.BeNumerically("<", time.Microsecond))
+
+	// Records written by Python may have integer timestamps.
+	record, err = parseLockRecord(map[any]any{"holder": "py", "expires_at": int64(1700000000)})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(record.expiresAt).Should(gomega.Equal(time.Unix(1700000000, 0)))
+
+	_, err = parseLockRecord("not a record")
+	g.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestNewLockDefaults(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	l := NewLock(&Dict{}, "leader", nil)
+	g.Expect(l.options.TTL).Should(gomega.Equal(lockDefaultTTL))
+	g.Expect(l.options.RenewInterval).Should(gomega.Equal(lockDefaultTTL / 3))
+	g.Expect(l.options.Holder).ShouldNot(gomega.BeEmpty())
+	g.Expect(l.tokenKey(3)).Should(gomega.Equal("leader:3"))
+
+	l = NewLock(&Dict{}, "leader", &LockOptions{TTL: time.Minute, RenewInterval: -1, Holder: "me"})
+	g.Expect(l.options.RenewInterval).Should(gomega.Equal(time.Duration(-1)))
+	g.Expect(l.options.Holder).Should(gomega.Equal("me"))
+}
+
+// fakeLockDict is an in-memory lockDict.
+type fakeLockDict struct {
+	mu      sync.Mutex
+	entries map[any]any
+}
+
+func newFakeLockDict() *fakeLockDict {
+	return &fakeLockDict{entries: map[any]any{}}
+}
+
+func (d *fakeLockDict) Get(key any) (any, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.entries[key]
+	return v, ok, nil
+}
+
+func (d *fakeLockDict) Put(key, value any, options *DictPutOptions) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.entries[key]; ok && options != nil && options.SkipIfExists {
+		return false, nil
+	}
+	d.entries[key] = value
+	return true, nil
+}
+
+func (d *fakeLockDict) Pop(key any) (any, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.entries[key]
+	delete(d.entries, key)
+	return v, ok, nil
+}
+
+func (d *fakeLockDict) Contains(key any) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.entries[key]
+	return ok, nil
+}
+
+func (d *fakeLockDict) keys() []any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var keys []any
+	for k := range d.entries {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestLockTokens(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dict := newFakeLockDict()
+	a := newLock(dict, "leader", &LockOptions{RenewInterval: -1, Holder: "a"})
+	b := newLock(dict, "leader", &LockOptions{RenewInterval: -1, Holder: "b"})
+
+	leaseA, err := a.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseA.Token).Should(gomega.Equal(int64(1)))
+	leaseB, err := b.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseB).Should(gomega.BeNil())
+
+	// Releasing removes the entry of the token, which is not reused.
+	g.Expect(leaseA.Release()).To(gomega.Succeed())
+	g.Expect(dict.keys()).Should(gomega.ConsistOf("leader"))
+	leaseB, err = b.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseB.Token).Should(gomega.Equal(int64(2)))
+	g.Expect(dict.keys()).Should(gomega.ConsistOf("leader", "leader:2"))
+
+	// Each acquisition removes the entries of released tokens.
+	g.Expect(leaseB.Renew()).To(gomega.Succeed())
+	g.Expect(leaseB.Release()).To(gomega.Succeed())
+	leaseA, err = a.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseA.Token).Should(gomega.Equal(int64(3)))
+	g.Expect(leaseA.Release()).To(gomega.Succeed())
+	leaseB, err = b.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseB.Token).Should(gomega.Equal(int64(4)))
+	g.Expect(leaseB.Release()).To(gomega.Succeed())
+	g.Expect(dict.keys()).Should(gomega.ConsistOf("leader"))
+}
+
+func TestLockExpiry(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dict := newFakeLockDict()
+	stale, err := newLock(dict, "leader", &LockOptions{TTL: 50 * time.Millisecond, RenewInterval: -1}).TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(stale.Token).Should(gomega.Equal(int64(1)))
+
+	other := newLock(dict, "leader", &LockOptions{RenewInterval: -1})
+	lease, err := other.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(lease).Should(gomega.BeNil())
+
+	// Once expired, the lease is taken over and its entry is removed.
+	time.Sleep(60 * time.Millisecond)
+	lease, err = other.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(lease.Token).Should(gomega.Equal(int64(2)))
+	g.Expect(dict.keys()).Should(gomega.ConsistOf("leader", "leader:2"))
+
+	g.Expect(stale.Valid()).To(gomega.BeFalse())
+	g.Expect(stale.Renew()).Should(gomega.HaveOccurred())
+	g.Expect(stale.Done()).To(gomega.BeClosed())
+	g.Expect(stale.Release()).To(gomega.Succeed())
+	g.Expect(dict.keys()).Should(gomega.ConsistOf("leader", "leader:2"))
+}
+
+func TestLeaseTakenOver(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	// A lease whose clock runs behind still notices that it was taken over,
+	// even after the new holder released the lock.
+	dict := newFakeLockDict()
+	slow, err := newLock(dict, "leader", &LockOptions{TTL: time.Hour, RenewInterval: -1}).TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	_, err = dict.Put("leader:1", lockRecord{holder: "slow"}.value(), nil) // expired for others
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	lease, err := newLock(dict, "leader", &LockOptions{RenewInterval: -1}).TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(lease.Token).Should(gomega.Equal(int64(2)))
+	g.Expect(lease.Release()).To(gomega.Succeed())
+
+	g.Expect(slow.Renew()).Should(gomega.MatchError(gomega.ContainSubstring("taken over")))
+	g.Expect(slow.Valid()).To(gomega.BeFalse())
+	g.Expect(dict.keys()).Should(gomega.ConsistOf("leader"))
+}
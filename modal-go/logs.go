@@ -0,0 +1,205 @@
+package modal
+
+// Line-oriented iteration over the output of Sandboxes and ContainerProcesses.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogLine is a line of output from a Sandbox or ContainerProcess.
+type LogLine struct {
+	Stream    FileDescriptor // Stream the line was written to.
+	Text      string         // Text of the line, without the trailing newline.
+	Timestamp time.Time      // Time Modal received the start of the line. Zero for ContainerProcess output.
+	EntryId   string         // Position after the line, to resume output after it with LogsOptions.LastEntryId.
+}
+
+// LogsOptions are options for Sandbox.Logs.
+type LogsOptions struct {
+	FileDescriptor FileDescriptor // Stream to read (default FileDescriptorStdout).
+	Since          time.Time      // Skip lines that started before this time.
+	LastEntryId    string         // Resume output after this position, from LogLine.EntryId.
+}
+
+// Logs returns the output of the Sandbox line by line, until the Sandbox
+// exits or iteration stops. Iteration stops at the first error, which is
+// yielded to the caller.
+func (sb *Sandbox) Logs(options *LogsOptions) iter.Seq2[LogLine, error] {
+	if options == nil {
+		options = &LogsOptions{}
+	}
+	fd := options.FileDescriptor
+	if fd == 0 {
+		fd = FileDescriptorStdout
+	}
+	source := sandboxOutputSource(sb.SandboxId, fd)
+	return iterateLines(sb.ctx, source, options.LastEntryId, options.Since)
+}
+
+// Lines returns the output of the process on a stream line by line, until
+// the process exits or iteration stops. Iteration stops at the first error,
+// which is yielded to the caller.
+func (cp *ContainerProcess) Lines(fd FileDescriptor) iter.Seq2[LogLine, error] {
+	source := withStreamMode(execOutputSource(cp.execId, fd), cp.mode)
+	return iterateLines(cp.ctx, source, "", time.Time{})
+}
+
+func iterateLines(ctx context.Context, source outputSource, lastEntryId string, since time.Time) iter.Seq2[LogLine, error] {
+	return func(yield func(LogLine, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		entryId, skip, err := parseLogPosition(lastEntryId)
+		if err != nil {
+			yield(LogLine{}, err)
+			return
+		}
+		splitter := lineSplitter{entryId: entryId}
+		stopped := false
+		emit := func(lines []LogLine) bool {
+			for _, line := range lines {
+				if !since.IsZero() && !line.Timestamp.IsZero() && line.Timestamp.Before(since) {
+					continue
+				}
+				if !yield(line, nil) {
+					stopped = true
+					return false
+				}
+			}
+			return true
+		}
+
+		err = readBatches(ctx, source, entryId, func(batch *outputBatch) bool {
+			for _, item := range batch.items {
+				// Skip the output of lines before the position that was resumed from.
+				n := min(skip, len(item.data))
+				item.data = item.data[n:]
+				skip -= n
+				splitter.offset += n
+				if !emit(splitter.push(item)) {
+					return false
+				}
+			}
+			splitter.endBatch(batch.entryId)
+			if batch.eof {
+				return emit(splitter.flush())
+			}
+			return true
+		})
+		if err != nil && !stopped {
+			yield(LogLine{}, err)
+		}
+	}
+}
+
+// lineSplitter splits output items into lines, buffering partial lines of
+// each stream until they are completed by a later item.
+//
+// The position after each line is the entry ID of the last batch before it
+// ended, and the number of bytes of output after that batch up to the end of
+// the line, so that output can be resumed at the line even if it ended in
+// the middle of a batch.
+type lineSplitter struct {
+	partial []partialLine
+	entryId string // last batch that was passed entirely
+	offset  int    // bytes of output passed since that batch
+}
+
+type partialLine struct {
+	fd        FileDescriptor
+	text      []byte
+	timestamp time.Time
+}
+
+// push adds an output item and returns the lines it completes.
+func (ls *lineSplitter) push(item outputItem) []LogLine {
+	var lines []LogLine
+	p := ls.partialFor(item.fd)
+	data := item.data
+	for len(data) > 0 {
+		if p.text == nil {
+			p.text = []byte{}
+			p.timestamp = item.timestamp
+		}
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			p.text = append(p.text, data...)
+			ls.offset += len(data)
+			break
+		}
+		p.text = append(p.text, data[:i]...)
+		data = data[i+1:]
+		ls.offset += i + 1
+		lines = append(lines, ls.take(p))
+	}
+	return lines
+}
+
+// endBatch marks the end of the items of a batch.
+func (ls *lineSplitter) endBatch(entryId string) {
+	if entryId != "" {
+		ls.entryId = entryId
+		ls.offset = 0
+	}
+}
+
+// flush returns the remaining partial lines, at the end of the output.
+func (ls *lineSplitter) flush() []LogLine {
+	var lines []LogLine
+	for i := range ls.partial {
+		if ls.partial[i].text != nil {
+			lines = append(lines, ls.take(&ls.partial[i]))
+		}
+	}
+	return lines
+}
+
+func (ls *lineSplitter) partialFor(fd FileDescriptor) *partialLine {
+	for i := range ls.partial {
+		if ls.partial[i].fd == fd {
+			return &ls.partial[i]
+		}
+	}
+	ls.partial = append(ls.partial, partialLine{fd: fd})
+	return &ls.partial[len(ls.partial)-1]
+}
+
+func (ls *lineSplitter) take(p *partialLine) LogLine {
+	line := LogLine{
+		Stream:    p.fd,
+		Text:      string(bytes.TrimSuffix(p.text, []byte("\r"))),
+		Timestamp: p.timestamp,
+		EntryId:   formatLogPosition(ls.entryId, ls.offset),
+	}
+	p.text = nil
+	p.timestamp = time.Time{}
+	return line
+}
+
+// formatLogPosition returns the position of output after an entry ID and an
+// offset, as "<entry ID>+<offset>", or only the entry ID for offset 0.
+func formatLogPosition(entryId string, offset int) string {
+	if offset == 0 {
+		return entryId
+	}
+	return entryId + "+" + strconv.Itoa(offset)
+}
+
+// parseLogPosition parses a position returned by formatLogPosition.
+func parseLogPosition(position string) (string, int, error) {
+	i := strings.LastIndexByte(position, '+')
+	if i < 0 {
+		return position, 0, nil
+	}
+	offset, err := strconv.Atoi(position[i+1:])
+	if err != nil || offset < 0 {
+		return "", 0, InvalidError{fmt.Sprintf("invalid log position: %q", position)}
+	}
+	return position[:i], offset, nil
+}
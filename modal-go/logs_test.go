@@ -0,0 +1,119 @@
+package modal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+)
+
+func TestLineSplitter(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	t1 := time.Unix(1, 0)
+	t2 := time.Unix(2, 0)
+	var ls lineSplitter
+
+	// A line split across items keeps the timestamp of its start.
+	g.Expect(ls.push(outputItem{data: []byte("hel"), fd: FileDescriptorStdout, timestamp: t1})).Should(gomega.BeEmpty())
+	g.Expect(ls.push(outputItem{data: []byte("err"), fd: FileDescriptorStderr, timestamp: t1})).Should(gomega.BeEmpty())
+	ls.endBatch("1")
+	lines := ls.push(outputItem{data: []byte("lo\r\nworld\nagain"), fd: FileDescriptorStdout, timestamp: t2})
+	g.Expect(lines).Should(gomega.Equal([]LogLine{
+		{Stream: FileDescriptorStdout, Text: "hello", Timestamp: t1, EntryId: "1+4"},
+		{Stream: FileDescriptorStdout, Text: "world", Timestamp: t2, EntryId: "1+10"},
+	}))
+	ls.endBatch("2")
+
+	// Empty lines are kept.
+	lines = ls.push(outputItem{data: []byte("\n\n"), fd: FileDescriptorStderr, timestamp: t2})
+	g.Expect(lines).Should(gomega.Equal([]LogLine{
+		{Stream: FileDescriptorStderr, Text: "err", Timestamp: t1, EntryId: "2+1"},
+		{Stream: FileDescriptorStderr, Text: "", Timestamp: t2, EntryId: "2+2"},
+	}))
+	ls.endBatch("3")
+
+	g.Expect(ls.flush()).Should(gomega.Equal([]LogLine{
+		{Stream: FileDescriptorStdout, Text: "again", Timestamp: t2, EntryId: "3"},
+	}))
+	g.Expect(ls.flush()).Should(gomega.BeEmpty())
+}
+
+func TestLogPosition(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	for _, position := range []string{"", "1700000000000-0", "1700000000000-0+12", "+3"} {
+		entryId, offset, err := parseLogPosition(position)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		g.Expect(formatLogPosition(entryId, offset)).Should(gomega.Equal(position))
+	}
+	_, _, err := parseLogPosition("1-0+x")
+	g.Expect(err).Should(gomega.BeAssignableToTypeOf(InvalidError{}))
+}
+
+func TestIterateLinesResume(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	source := &fakeOutputSource{batches: []*outputBatch{
+		{entryId: "1", items: []outputItem{{data: []byte("a\nb")}}},
+		{entryId: "2", items: []outputItem{{data: []byte("b\nc\n")}, {data: []byte("dd\ne")}}},
+		{entryId: "3", items: []outputItem{{data: []byte("e\n")}}, eof: true},
+	}}
+	readAll := func(lastEntryId string) []LogLine {
+		var lines []LogLine
+		for line, err := range iterateLines(context.Background(), source.open, lastEntryId, time.Time{}) {
+			g.Expect(err).ShouldNot(gomega.HaveOccurred())
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	lines := readAll("")
+	var texts []string
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	g.Expect(texts).Should(gomega.Equal([]string{"a", "bb", "c", "dd", "ee"}))
+
+	// Resuming after any line, including ones in the middle of a batch,
+	// returns exactly the lines after it.
+	for i, line := range lines {
+		resumed := []string{}
+		for _, l := range readAll(line.EntryId) {
+			resumed = append(resumed, l.Text)
+		}
+		g.Expect(resumed).Should(gomega.Equal(texts[i+1:]), "resuming after %q at %s", line.Text, line.EntryId)
+	}
+}
+
+func TestIterateLines(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	source := &fakeOutputSource{batches: []*outputBatch{
+		{entryId: "1", items: []outputItem{{data: []byte("old\nne"), timestamp: time.Unix(10, 0)}}},
+		{entryId: "2", items: []outputItem{{data: []byte("w\nlast"), timestamp: time.Unix(20, 0)}}, eof: true},
+	}}
+
+	var texts []string
+	for line, err := range iterateLines(context.Background(), source.open, "", time.Unix(10, 0).Add(time.Millisecond)) {
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		texts = append(texts, line.Text)
+	}
+	// "ne" started before the cutoff, so the whole line "new" is skipped.
+	g.Expect(texts).Should(gomega.Equal([]string{"last"}))
+
+	texts = nil
+	for line, err := range iterateLines(context.Background(), source.open, "", time.Time{}) {
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		texts = append(texts, line.Text)
+		if len(texts) == 2 {
+			break
+		}
+	}
+	g.Expect(texts).Should(gomega.Equal([]string{"old", "new"}))
+}
@@ -0,0 +1,376 @@
+package modal
+
+// mount.go implements Mounts, which upload local files into Sandboxes and
+// Image builds.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+)
+
+// mountUploadConcurrency is the number of files uploaded in parallel.
+const mountUploadConcurrency = 16
+
+// Mount is a set of local files uploaded to Modal, which can be added to
+// Sandboxes with SandboxOptions.Mounts.
+type Mount struct {
+	MountId string
+
+	//lint:ignore U1000 may be used in future
+	ctx context.Context
+}
+
+// MountOptions are options for creating a Mount from local files.
+type MountOptions struct {
+	// Ignore excludes files matching these patterns, which follow the syntax
+	// of .dockerignore files and are relative to the local directory.
+	Ignore      []string
+	Environment string // Environment to create the Mount in.
+}
+
+// mountFile is a local file to be included in a Mount.
+type mountFile struct {
+	localPath  string
+	remotePath string
+	sha256Hex  string
+	size       int64
+	mode       fs.FileMode
+}
+
+// MountFromLocalDir uploads the files of a local directory, and returns a
+// Mount that places them under remotePath.
+//
+// Files are identified by their content hash, so only files that Modal has
+// not seen before are uploaded.
+func MountFromLocalDir(ctx context.Context, localPath, remotePath string, options *MountOptions) (*Mount, error) {
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if options == nil {
+		options = &MountOptions{}
+	}
+	if !path.IsAbs(remotePath) {
+		return nil, InvalidError{Exception: fmt.Sprintf("remote path %q of Mount must be absolute", remotePath)}
+	}
+	matcher, err := newFilePatternMatcher(options.Ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listMountFiles(localPath, remotePath, matcher, nil)
+	if err != nil {
+		return nil, err
+	}
+	return createMount(ctx, files, options.Environment)
+}
+
+// createMount uploads files that Modal does not have yet and creates an
+// ephemeral Mount of them.
+func createMount(ctx context.Context, files []mountFile, environment string) (*Mount, error) {
+	if err := uploadMountFiles(ctx, files); err != nil {
+		return nil, err
+	}
+
+	mountFiles := make([]*pb.MountFile, len(files))
+	for i, f := range files {
+		mountFiles[i] = pb.MountFile_builder{
+			Filename:  f.remotePath,
+			Sha256Hex: f.sha256Hex,
+			Size:      ptr(uint64(f.size)),
+			Mode:      ptr(uint32(f.mode.Perm())),
+		}.Build()
+	}
+	resp, err := client.MountGetOrCreate(ctx, pb.MountGetOrCreateRequest_builder{
+		ObjectCreationType: pb.ObjectCreationType_OBJECT_CREATION_TYPE_EPHEMERAL,
+		EnvironmentName:    environmentName(environment),
+		Files:              mountFiles,
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mount{MountId: resp.GetMountId(), ctx: ctx}, nil
+}
+
+// listMountFiles hashes the regular files under localPath that are not
+// ignored, in lexical order. If include is not nil, only files it matches are
+// listed. Symbolic links to files are followed.
+func listMountFiles(localPath, remotePath string, ignore, include *filePatternMatcher) ([]mountFile, error) {
+	var files []mountFile
+	err := filepath.WalkDir(localPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if ignore.skipDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignore.matches(rel) || (include != nil && !include.matches(rel)) {
+			return nil
+		}
+
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		sha256Hex, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, mountFile{
+			localPath:  p,
+			remotePath: path.Join(remotePath, rel),
+			sha256Hex:  sha256Hex,
+			size:       info.Size(),
+			mode:       info.Mode(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// uploadMountFiles uploads the contents of files that Modal does not have yet.
+func uploadMountFiles(ctx context.Context, files []mountFile) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		uploaded = map[string]bool{}
+	)
+	sem := make(chan struct{}, mountUploadConcurrency)
+	for _, f := range files {
+		// Files with the same content only need to be uploaded once.
+		if uploaded[f.sha256Hex] {
+			continue
+		}
+		uploaded[f.sha256Hex] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := uploadMountFile(ctx, f); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func uploadMountFile(ctx context.Context, f mountFile) error {
+	resp, err := client.MountPutFile(ctx, pb.MountPutFileRequest_builder{
+		Sha256Hex: f.sha256Hex,
+	}.Build())
+	if err != nil {
+		return err
+	}
+	if resp.GetExists() {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.localPath)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != f.sha256Hex {
+		return ExecutionError{Exception: fmt.Sprintf("file %s changed while creating Mount", f.localPath)}
+	}
+	req := pb.MountPutFileRequest_builder{Sha256Hex: f.sha256Hex}.Build()
+	if len(data) > maxObjectSizeBytes {
+		blobId, err := blobUpload(ctx, data)
+		if err != nil {
+			return err
+		}
+		req.SetDataBlobId(blobId)
+	} else {
+		req.SetData(data)
+	}
+	_, err = client.MountPutFile(ctx, req)
+	return err
+}
+
+// filePatternMatcher matches slash-separated relative paths against patterns
+// with the syntax of .dockerignore files. A path matches if it or any of its
+// parent directories matches a pattern, patterns starting with "!" re-include
+// paths, and the last matching pattern wins.
+type filePatternMatcher struct {
+	patterns []filePattern
+}
+
+type filePattern struct {
+	re      *regexp.Regexp
+	exclude bool // pattern starts with "!"
+}
+
+func newFilePatternMatcher(patterns []string) (*filePatternMatcher, error) {
+	m := &filePatternMatcher{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		exclude := strings.HasPrefix(p, "!")
+		if exclude {
+			p = strings.TrimSpace(p[1:])
+		}
+		if p == "" {
+			continue
+		}
+		p = strings.TrimPrefix(path.Clean(filepath.ToSlash(p)), "/")
+		if p == "." || p == "" {
+			p = "**" // the whole directory
+		}
+		re, err := patternToRegexp(p)
+		if err != nil {
+			return nil, InvalidError{Exception: fmt.Sprintf("invalid ignore pattern %q: %v", p, err)}
+		}
+		m.patterns = append(m.patterns, filePattern{re: re, exclude: exclude})
+	}
+	return m, nil
+}
+
+// matches reports whether a path is ignored.
+func (m *filePatternMatcher) matches(rel string) bool {
+	parents := []string{}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		parents = append(parents, dir)
+	}
+
+	matched := false
+	for _, p := range m.patterns {
+		if p.re.MatchString(rel) {
+			matched = !p.exclude
+			continue
+		}
+		for _, dir := range parents {
+			if p.re.MatchString(dir) {
+				matched = !p.exclude
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// skipDir reports whether a directory can be skipped entirely, which is only
+// the case if it is ignored and no pattern could re-include its contents.
+func (m *filePatternMatcher) skipDir(rel string) bool {
+	for _, p := range m.patterns {
+		if p.exclude {
+			return false
+		}
+	}
+	return m.matches(rel)
+}
+
+// patternToRegexp converts a pattern to a regular expression, where "*"
+// matches within a path segment and "**" matches any number of segments.
+func patternToRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// mountIds returns the IDs of mounts, skipping nil entries.
+func mountIds(mounts []*Mount) []string {
+	ids := []string{}
+	for _, m := range mounts {
+		if m != nil {
+			ids = append(ids, m.MountId)
+		}
+	}
+	return ids
+}
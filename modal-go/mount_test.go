@@ -0,0 +1,59 @@
+package modal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestFilePatternMatcher(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	m, err := newFilePatternMatcher([]string{
+		"*.pyc",
+		"node_modules",
+		"docs/**/*.md",
+		"!docs/README.md",
+		"",
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	g.Expect(m.matches("main.pyc")).Should(gomega.BeTrue())
+	g.Expect(m.matches("pkg/main.pyc")).Should(gomega.BeFalse()) // "*" does not cross directories
+	g.Expect(m.matches("node_modules/left-pad/index.js")).Should(gomega.BeTrue())
+	g.Expect(m.matches("docs/guide.md")).Should(gomega.BeTrue())
+	g.Expect(m.matches("docs/a/b/guide.md")).Should(gomega.BeTrue())
+	g.Expect(m.matches("docs/README.md")).Should(gomega.BeFalse())
+	g.Expect(m.matches("main.py")).Should(gomega.BeFalse())
+
+	g.Expect(m.skipDir("node_modules")).Should(gomega.BeFalse()) // "!" patterns may re-include files
+
+	_, err = newFilePatternMatcher([]string{"[abc"})
+	g.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestListMountFiles(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dir := t.TempDir()
+	g.Expect(os.MkdirAll(filepath.Join(dir, "src", "cache"), 0o755)).Should(gomega.Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "src", "main.py"), []byte("print('hi')\n"), 0o755)).Should(gomega.Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "src", "cache", "x.bin"), []byte("x"), 0o644)).Should(gomega.Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello"), 0o644)).Should(gomega.Succeed())
+
+	m, err := newFilePatternMatcher([]string{"**/cache"})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	files, err := listMountFiles(dir, "/app", m, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	g.Expect(files).Should(gomega.HaveLen(2))
+	g.Expect(files[0].remotePath).Should(gomega.Equal("/app/README.md"))
+	g.Expect(files[0].sha256Hex).Should(gomega.Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))
+	g.Expect(files[0].size).Should(gomega.Equal(int64(5)))
+	g.Expect(files[1].remotePath).Should(gomega.Equal("/app/src/main.py"))
+	g.Expect(files[1].mode.Perm()).Should(gomega.Equal(os.FileMode(0o755)))
+}
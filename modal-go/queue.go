@@ -54,6 +54,30 @@ type QueueLenOptions struct {
 type QueueIterateOptions struct {
 	ItemPollTimeout time.Duration // exit if no new items within this period
 	Partition       string
+	LastEntryId     string // resume after this entry, from QueueEntry.EntryId (default: from the start)
+}
+
+// QueueListOptions are options for listing named queues.
+type QueueListOptions struct {
+	Environment string // Environment to list queues in.
+
+	// TotalSizeLimit caps the sizes that are counted per queue, to make
+	// listing faster (default: no limit).
+	TotalSizeLimit int
+}
+
+// QueueInfo describes a named queue, as returned by QueueList.
+type QueueInfo struct {
+	Name          string
+	CreatedAt     time.Time
+	NumPartitions int
+	TotalSize     int // Number of items in all partitions.
+}
+
+// QueueEntry is an item read from a queue without removing it.
+type QueueEntry struct {
+	EntryId string // ID of the entry, to resume iteration with QueueIterateOptions.LastEntryId.
+	Value   any
 }
 
 // Queue is a distributed, FIFO queue for data flow in Modal apps.
@@ -145,14 +169,47 @@ func QueueLookup(ctx context.Context, name string, options *LookupOptions) (*Que
 
 // QueueDelete removes a queue by name.
 func QueueDelete(ctx context.Context, name string, options *DeleteOptions) error {
+	if options == nil {
+		options = &DeleteOptions{}
+	}
 	q, err := QueueLookup(ctx, name, &LookupOptions{Environment: options.Environment})
 	if err != nil {
 		return err
 	}
-	_, err = client.QueueDelete(ctx, pb.QueueDeleteRequest_builder{QueueId: q.QueueId}.Build())
+	_, err = client.QueueDelete(q.ctx, pb.QueueDeleteRequest_builder{QueueId: q.QueueId}.Build())
 	return err
 }
 
+// QueueList lists the named queues of an environment.
+func QueueList(ctx context.Context, options *QueueListOptions) ([]QueueInfo, error) {
+	if options == nil {
+		options = &QueueListOptions{}
+	}
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.QueueList(ctx, pb.QueueListRequest_builder{
+		EnvironmentName: environmentName(options.Environment),
+		TotalSizeLimit:  int32(options.TotalSizeLimit),
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+	queues := make([]QueueInfo, len(resp.GetQueues()))
+	for i, info := range resp.GetQueues() {
+		queues[i] = QueueInfo{
+			Name:          info.GetName(),
+			CreatedAt:     timeFromSeconds(info.GetCreatedAt()),
+			NumPartitions: int(info.GetNumPartitions()),
+			TotalSize:     int(info.GetTotalSize()),
+		}
+	}
+	return queues, nil
+}
+
 // Clear removes all objects from a queue partition.
 func (q *Queue) Clear(options *QueueClearOptions) error {
 	if options == nil {
@@ -175,6 +232,23 @@ func (q *Queue) Clear(options *QueueClearOptions) error {
 
 // internal helper for both Get and GetMany.
 func (q *Queue) get(n int, options *QueueGetOptions) ([]any, error) {
+	values, err := q.getRaw(n, options)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, len(values))
+	for i, raw := range values {
+		v, err := pickleDeserialize(raw)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// getRaw removes up to n encoded items.
+func (q *Queue) getRaw(n int, options *QueueGetOptions) ([][]byte, error) {
 	if options == nil {
 		options = &QueueGetOptions{}
 	}
@@ -200,15 +274,7 @@ func (q *Queue) get(n int, options *QueueGetOptions) ([]any, error) {
 			return nil, err
 		}
 		if len(resp.GetValues()) > 0 {
-			out := make([]any, len(resp.GetValues()))
-			for i, raw := range resp.GetValues() {
-				v, err := pickleDeserialize(raw)
-				if err != nil {
-					return nil, err
-				}
-				out[i] = v
-			}
-			return out, nil
+			return resp.GetValues(), nil
 		}
 		if options.Timeout != nil {
 			remaining := *options.Timeout - time.Since(startTime)
@@ -245,14 +311,6 @@ func (q *Queue) GetMany(n int, options *QueueGetOptions) ([]any, error) {
 
 // internal put helper (single/many).
 func (q *Queue) put(values []any, options *QueuePutOptions) error {
-	if options == nil {
-		options = &QueuePutOptions{}
-	}
-	key, err := validatePartitionKey(options.Partition)
-	if err != nil {
-		return err
-	}
-
 	valuesEncoded := make([][]byte, len(values))
 	for i, v := range values {
 		b, err := pickleSerialize(v)
@@ -261,6 +319,18 @@ func (q *Queue) put(values []any, options *QueuePutOptions) error {
 		}
 		valuesEncoded[i] = b.Bytes()
 	}
+	return q.putRaw(valuesEncoded, options)
+}
+
+// putRaw adds encoded items to the end of the queue.
+func (q *Queue) putRaw(valuesEncoded [][]byte, options *QueuePutOptions) error {
+	if options == nil {
+		options = &QueuePutOptions{}
+	}
+	key, err := validatePartitionKey(options.Partition)
+	if err != nil {
+		return err
+	}
 
 	deadline := time.Time{}
 	if options.Timeout != nil {
@@ -346,20 +416,65 @@ func (q *Queue) Len(options *QueueLenOptions) (int, error) {
 	return int(resp.GetLen()), nil
 }
 
-// Iterate yields items from the queue until it is empty.
+// Iterate yields items from the queue until it is empty, without removing
+// them. Items that can't be unpickled are yielded as a QueueDecodeError, and
+// iteration continues with the next item.
 func (q *Queue) Iterate(options *QueueIterateOptions) iter.Seq2[any, error] {
+	return func(yield func(any, error) bool) {
+		for entry, err := range q.IterateEntries(options) {
+			if !yield(entry.Value, err) {
+				return
+			}
+		}
+	}
+}
+
+// IterateEntries is like Iterate, but also yields the ID of each entry. A
+// reader can save the ID of the last entry it processed, and resume after it
+// with QueueIterateOptions.LastEntryId.
+func (q *Queue) IterateEntries(options *QueueIterateOptions) iter.Seq2[QueueEntry, error] {
+	return func(yield func(QueueEntry, error) bool) {
+		for item, err := range q.iterateRaw(options) {
+			if err != nil {
+				yield(QueueEntry{}, err)
+				return
+			}
+			entry := QueueEntry{EntryId: item.entryId}
+			v, err := pickleDeserialize(item.data)
+			if err != nil {
+				if !yield(entry, QueueDecodeError{Data: item.data, Err: err}) {
+					return
+				}
+				continue
+			}
+			entry.Value = v
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// queueItem is an encoded item read from a queue without removing it.
+type queueItem struct {
+	entryId string
+	data    []byte
+}
+
+// iterateRaw yields encoded items from the queue until it is empty.
+func (q *Queue) iterateRaw(options *QueueIterateOptions) iter.Seq2[queueItem, error] {
 	if options == nil {
 		options = &QueueIterateOptions{}
 	}
 
 	itemPoll := options.ItemPollTimeout
-	lastEntryID := ""
 	maxPoll := 30 * time.Second
 
-	return func(yield func(any, error) bool) {
+	return func(yield func(queueItem, error) bool) {
+		lastEntryID := options.LastEntryId
 		key, err := validatePartitionKey(options.Partition)
 		if err != nil {
-			yield(nil, err)
+			yield(queueItem{}, err)
 			return
 		}
 
@@ -373,16 +488,12 @@ func (q *Queue) Iterate(options *QueueIterateOptions) iter.Seq2[any, error] {
 				LastEntryId:     lastEntryID,
 			}.Build())
 			if err != nil {
-				yield(nil, err)
+				yield(queueItem{}, err)
 				return
 			}
 			if len(resp.GetItems()) > 0 {
 				for _, item := range resp.GetItems() {
-					v, err := pickleDeserialize(item.GetValue())
-					if err != nil {
-						return
-					}
-					if !yield(v, nil) {
+					if !yield(queueItem{entryId: item.GetEntryId(), data: item.GetValue()}, nil) {
 						return
 					}
 					lastEntryID = item.GetEntryId()
@@ -0,0 +1,230 @@
+package modal
+
+// queue_chan.go connects Queues to Go channels.
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+)
+
+const (
+	queueChanDefaultPollTimeout = 5 * time.Second
+	queueSinkDefaultBatchSize   = 100
+	queueSinkDefaultLinger      = 50 * time.Millisecond
+)
+
+// QueueChanOptions are options for Queue.Chan.
+type QueueChanOptions struct {
+	Partition string
+
+	// Peek reads items with QueueNextItems without removing them, starting
+	// from the oldest item, like Iterate. By default, items are removed from
+	// the queue like Get.
+	Peek bool
+
+	BatchSize   int           // Max items removed per request (default 1).
+	PollTimeout time.Duration // Time each request waits for items, which bounds cancellation latency (default 5s).
+}
+
+// QueueSinkOptions are options for Queue.Sink.
+type QueueSinkOptions struct {
+	Partition    string
+	PartitionTtl time.Duration // ttl for the *partition* (default 24h)
+	MaxBatchSize int           // Max items per PutMany (default 100).
+	Linger       time.Duration // Max time an item waits for a batch to fill up (default 50ms).
+}
+
+// Chan returns a channel that receives the items of the queue until ctx is
+// cancelled or an error occurs, and a function that waits for the channel to
+// be closed and returns the error that closed it, if any.
+//
+// Items removed from the queue that were not received before ctx is
+// cancelled are put back at the end of their partition. Items that can't be
+// unpickled close the channel with a QueueDecodeError.
+func (q *Queue) Chan(ctx context.Context, options *QueueChanOptions) (<-chan any, func() error) {
+	if options == nil {
+		options = &QueueChanOptions{}
+	}
+	opts := *options
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1
+	}
+	if opts.PollTimeout <= 0 {
+		opts.PollTimeout = queueChanDefaultPollTimeout
+	}
+
+	out := make(chan any)
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		defer close(out)
+		if opts.Peek {
+			err = q.peekToChan(ctx, out, opts)
+		} else {
+			err = q.getToChan(ctx, out, opts)
+		}
+	}()
+	return out, func() error {
+		<-done
+		return err
+	}
+}
+
+func (q *Queue) getToChan(ctx context.Context, out chan<- any, opts QueueChanOptions) error {
+	getOptions := &QueueGetOptions{Timeout: &opts.PollTimeout, Partition: opts.Partition}
+	for ctx.Err() == nil {
+		values, err := q.getRaw(opts.BatchSize, getOptions)
+		var emptyErr QueueEmptyError
+		if errors.As(err, &emptyErr) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for i, data := range values {
+			v, err := pickleDeserialize(data)
+			if err != nil {
+				return errors.Join(QueueDecodeError{Data: data, Err: err}, q.putBack(values[i+1:], opts.Partition))
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return q.putBack(values[i:], opts.Partition)
+			}
+		}
+	}
+	return nil
+}
+
+// putBack returns removed items that were not received to the queue.
+func (q *Queue) putBack(values [][]byte, partition string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return q.putRaw(values, &QueuePutOptions{Partition: partition})
+}
+
+func (q *Queue) peekToChan(ctx context.Context, out chan<- any, opts QueueChanOptions) error {
+	key, err := validatePartitionKey(opts.Partition)
+	if err != nil {
+		return err
+	}
+	rpcCtx, err := clientContext(ctx)
+	if err != nil {
+		return err
+	}
+	lastEntryID := ""
+	for ctx.Err() == nil {
+		resp, err := client.QueueNextItems(rpcCtx, pb.QueueNextItemsRequest_builder{
+			QueueId:         q.QueueId,
+			PartitionKey:    key,
+			ItemPollTimeout: float32(opts.PollTimeout.Seconds()),
+			LastEntryId:     lastEntryID,
+		}.Build())
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, item := range resp.GetItems() {
+			v, err := pickleDeserialize(item.GetValue())
+			if err != nil {
+				return QueueDecodeError{Data: item.GetValue(), Err: err}
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return nil
+			}
+			lastEntryID = item.GetEntryId()
+		}
+	}
+	return nil
+}
+
+// Sink returns a channel whose values are put into the queue in batches, and
+// a function that waits for all sent values to be put and returns their
+// errors, joined with errors.Join. Close the channel when done sending, then
+// call the function.
+//
+// A batch is put when it reaches MaxBatchSize, or when its oldest value has
+// waited for Linger. Values that can't be pickled and batches that fail to be
+// put are dropped and reported by the function, and later values are still
+// put. If ctx is cancelled, the current batch is put and later values are
+// dropped; senders should also stop on ctx.
+func (q *Queue) Sink(ctx context.Context, options *QueueSinkOptions) (chan<- any, func() error) {
+	if options == nil {
+		options = &QueueSinkOptions{}
+	}
+	opts := *options
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = queueSinkDefaultBatchSize
+	}
+	if opts.Linger <= 0 {
+		opts.Linger = queueSinkDefaultLinger
+	}
+
+	in := make(chan any, opts.MaxBatchSize)
+	done := make(chan struct{})
+	var errs []error
+	go func() {
+		defer close(done)
+		putOptions := &QueuePutOptions{Partition: opts.Partition, PartitionTtl: opts.PartitionTtl}
+		var batch [][]byte
+		flush := func() {
+			if len(batch) > 0 {
+				if err := q.putRaw(batch, putOptions); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			batch = nil
+		}
+
+		linger := time.NewTimer(opts.Linger)
+		linger.Stop()
+		defer linger.Stop()
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				if ctx.Err() != nil {
+					continue // drain, so that senders don't block
+				}
+				b, err := pickleSerialize(v)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				batch = append(batch, b.Bytes())
+				if len(batch) == 1 {
+					linger.Reset(opts.Linger)
+				}
+				if len(batch) >= opts.MaxBatchSize {
+					linger.Stop()
+					flush()
+				}
+			case <-linger.C:
+				flush()
+			case <-ctx.Done():
+				linger.Stop()
+				flush()
+				// Keep draining until the channel is closed.
+				for range in {
+				}
+				return
+			}
+		}
+	}()
+	return in, func() error {
+		<-done
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,245 @@
+package modal
+
+// queue_codec.go defines how typed Queue items are encoded.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	pickle "github.com/kisielk/og-rek"
+	"google.golang.org/protobuf/proto"
+)
+
+// QueueCodec encodes and decodes the items of a TypedQueue.
+type QueueCodec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// PickleCodec returns a QueueCodec that stores items as Python pickles, so
+// they can be shared with Python Modal Functions. This is the format used by
+// Queue.
+//
+// Structs and types containing them are converted to Python objects through
+// their encoding/json representation, so structs are stored as dicts keyed by
+// their JSON field names.
+func PickleCodec[T any]() QueueCodec[T] {
+	return pickleCodec[T]{}
+}
+
+// JSONCodec returns a QueueCodec that stores items as JSON.
+func JSONCodec[T any]() QueueCodec[T] {
+	return jsonCodec[T]{}
+}
+
+// BytesCodec returns a QueueCodec that stores byte slices as they are, for
+// items encoded by the caller.
+func BytesCodec() QueueCodec[[]byte] {
+	return bytesCodec{}
+}
+
+// ProtoCodec returns a QueueCodec that stores protobuf messages in their
+// binary wire format.
+func ProtoCodec[T proto.Message]() QueueCodec[T] {
+	return protoCodec[T]{}
+}
+
+type pickleCodec[T any] struct{}
+
+func (pickleCodec[T]) Encode(v T) ([]byte, error) {
+	var value any = v
+	if typeHasStruct(reflect.TypeFor[T](), map[reflect.Type]bool{}) {
+		var err error
+		value, err = jsonToPickleValue(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b, err := pickleSerialize(value)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (pickleCodec[T]) Decode(data []byte) (T, error) {
+	var out T
+	v, err := pickleDeserialize(data)
+	if err != nil {
+		return out, err
+	}
+	if t, ok := v.(T); ok {
+		return t, nil
+	}
+	if b, ok := v.(pickle.Bytes); ok {
+		if t, ok := any([]byte(b)).(T); ok {
+			return t, nil
+		}
+	}
+
+	value, err := pickleToJSONValue(v)
+	if err != nil {
+		return out, err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return out, err
+	}
+	if err := json.Unmarshal(encoded, &out); err != nil {
+		return out, fmt.Errorf("error converting %T to %T: %w", v, out, err)
+	}
+	return out, nil
+}
+
+// typeHasStruct reports whether values of a type may contain structs, which
+// pickle needs to convert through JSON.
+func typeHasStruct(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return typeHasStruct(t.Elem(), seen)
+	case reflect.Map:
+		return typeHasStruct(t.Key(), seen) || typeHasStruct(t.Elem(), seen)
+	}
+	return false
+}
+
+// jsonToPickleValue converts a value to the basic types that pickle encodes,
+// through its JSON representation.
+func jsonToPickleValue(v any) (any, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return fromJSONNumbers(value), nil
+}
+
+func fromJSONNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		n, _ := new(big.Int).SetString(v.String(), 10)
+		return n
+	case []any:
+		for i := range v {
+			v[i] = fromJSONNumbers(v[i])
+		}
+		return v
+	case map[string]any:
+		for k := range v {
+			v[k] = fromJSONNumbers(v[k])
+		}
+		return v
+	}
+	return v
+}
+
+// pickleToJSONValue converts a decoded pickle to values that encoding/json
+// can encode, so it can be decoded into any Go type.
+func pickleToJSONValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, pickle.None:
+		return nil, nil
+	case bool, int64, float64, string:
+		return v, nil
+	case *big.Int:
+		return json.Number(v.String()), nil
+	case pickle.Bytes:
+		return []byte(v), nil
+	case pickle.ByteString:
+		return string(v), nil
+	case []any:
+		return pickleSliceToJSON(v)
+	case pickle.Tuple:
+		return pickleSliceToJSON(v)
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			var name string
+			switch key := key.(type) {
+			case string:
+				name = key
+			case int64:
+				name = strconv.FormatInt(key, 10)
+			case bool:
+				name = strconv.FormatBool(key)
+			default:
+				return nil, fmt.Errorf("unsupported pickled dict key of type %T", key)
+			}
+			converted, err := pickleToJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = converted
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported pickled value of type %T", v)
+}
+
+func pickleSliceToJSON(values []any) ([]any, error) {
+	out := make([]any, len(values))
+	for i, value := range values {
+		converted, err := pickleToJSONValue(value)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = converted
+	}
+	return out, nil
+}
+
+type jsonCodec[T any] struct{}
+
+func (jsonCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var out T
+	err := json.Unmarshal(data, &out)
+	return out, err
+}
+
+type bytesCodec struct{}
+
+func (bytesCodec) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (bytesCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+type protoCodec[T proto.Message] struct{}
+
+func (protoCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (protoCodec[T]) Decode(data []byte) (T, error) {
+	var zero T
+	out := zero.ProtoReflect().Type().New().Interface().(T)
+	err := proto.Unmarshal(data, out)
+	return out, err
+}
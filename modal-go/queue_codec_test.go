@@ -0,0 +1,69 @@
+package modal
+
+import (
+	"testing"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"github.com/onsi/gomega"
+)
+
+type testQueueTask struct {
+	Name     string            `json:"name"`
+	Priority int               `json:"priority"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Payload  []byte            `json:"payload,omitempty"`
+}
+
+func roundTrip[T any](g *gomega.WithT, codec QueueCodec[T], v T) T {
+	data, err := codec.Encode(v)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	out, err := codec.Decode(data)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	return out
+}
+
+func TestPickleCodec(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	task := testQueueTask{Name: "resize", Priority: 2, Labels: map[string]string{"a": "b"}, Payload: []byte{0, 1}}
+	g.Expect(roundTrip(g, PickleCodec[testQueueTask](), task)).Should(gomega.Equal(task))
+	g.Expect(roundTrip(g, PickleCodec[*testQueueTask](), &task)).Should(gomega.Equal(&task))
+	g.Expect(roundTrip(g, PickleCodec[int](), 42)).Should(gomega.Equal(42))
+	g.Expect(roundTrip(g, PickleCodec[[]byte](), []byte("raw"))).Should(gomega.Equal([]byte("raw")))
+	g.Expect(roundTrip(g, PickleCodec[map[string]int](), map[string]int{"x": 1})).Should(gomega.Equal(map[string]int{"x": 1}))
+	g.Expect(roundTrip(g, PickleCodec[[]string](), []string{"a", "b"})).Should(gomega.Equal([]string{"a", "b"}))
+
+	// Values pickled by Queue, like Python dicts, decode into typed values.
+	data, err := pickleSerialize(map[any]any{"name": "crop", "priority": int64(1)})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	decoded, err := PickleCodec[testQueueTask]().Decode(data.Bytes())
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(decoded).Should(gomega.Equal(testQueueTask{Name: "crop", Priority: 1}))
+
+	// Structs are stored as dicts, which Queue and Python can read.
+	data2, err := PickleCodec[testQueueTask]().Encode(testQueueTask{Name: "crop", Priority: 1})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	raw, err := pickleDeserialize(data2)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(raw).Should(gomega.Equal(map[any]any{"name": "crop", "priority": int64(1)}))
+
+	_, err = PickleCodec[int]().Decode(data.Bytes())
+	g.Expect(err).Should(gomega.HaveOccurred())
+	_, err = PickleCodec[int]().Decode([]byte("not a pickle"))
+	g.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestJSONAndProtoCodecs(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	task := testQueueTask{Name: "resize", Priority: 2}
+	g.Expect(roundTrip(g, JSONCodec[testQueueTask](), task)).Should(gomega.Equal(task))
+	g.Expect(roundTrip(g, BytesCodec(), []byte("raw"))).Should(gomega.Equal([]byte("raw")))
+
+	msg := pb.MountFile_builder{Filename: "/app/main.py", Sha256Hex: "abc"}.Build()
+	decoded := roundTrip(g, ProtoCodec[*pb.MountFile](), msg)
+	g.Expect(decoded.GetFilename()).Should(gomega.Equal("/app/main.py"))
+	g.Expect(decoded.GetSha256Hex()).Should(gomega.Equal("abc"))
+}
@@ -0,0 +1,263 @@
+package modal
+
+// queue_consumer.go implements a pool of workers that process Queue items.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pickle "github.com/kisielk/og-rek"
+)
+
+const (
+	queueConsumerDefaultMaxRetries  = 3
+	queueConsumerDefaultPollTimeout = 5 * time.Second
+
+	// queueRetryKey marks items that are re-enqueued after failing.
+	queueRetryKey = "__modal_queue_retry__"
+)
+
+// QueueHandler processes a Queue item. An error or panic marks the item as
+// failed, so it is retried.
+type QueueHandler[T any] func(ctx context.Context, item T) error
+
+// QueueConsumerOptions are options for NewQueueConsumer.
+type QueueConsumerOptions struct {
+	Partitions  []string      // Partitions to consume (default: the default partition).
+	Concurrency int           // Number of items processed in parallel (default 1).
+	MaxRetries  int           // Times a failed item is retried (default 3, negative for none).
+	PollTimeout time.Duration // Time each Get waits for items, which bounds shutdown latency (default 5s).
+
+	// DeadLetter receives items that failed after all retries, could not be
+	// decoded, or could not be put back for a retry. If nil, these items are
+	// dropped.
+	DeadLetter *Queue
+
+	// OnError is called with errors of handlers and of the consumer itself,
+	// like failures to get or re-enqueue items, if set.
+	OnError func(error)
+}
+
+// QueueConsumerStats are counters of a QueueConsumer.
+type QueueConsumerStats struct {
+	Processed    int64   // Items handled successfully.
+	Failed       int64   // Failed handler calls, including ones that were retried.
+	Retried      int64   // Items re-enqueued after failing.
+	DeadLettered int64   // Items moved to the dead-letter queue, or dropped.
+	Pending      int     // Items waiting in the consumed partitions.
+	Throughput   float64 // Processed items per second since Run started.
+}
+
+// QueueConsumer processes the items of a Queue with a pool of goroutines.
+//
+// Failed items are put back at the end of their partition with a retry count,
+// so other consumers may pick them up. Retried items are wrapped in a Python
+// dict with the retry count, which Python consumers of the Queue would see.
+// Items that can't be put back are moved to the dead-letter queue.
+//
+// Delivery is at most once: items are removed from the Queue before they are
+// handled, so an item is lost if the process crashes while handling it.
+type QueueConsumer[T any] struct {
+	queue   *TypedQueue[T]
+	handler QueueHandler[T]
+	options QueueConsumerOptions
+
+	started      atomic.Int64 // UnixNano of the start of Run
+	processed    atomic.Int64
+	failed       atomic.Int64
+	retried      atomic.Int64
+	deadLettered atomic.Int64
+}
+
+// NewQueueConsumer returns a QueueConsumer that calls handler for each item
+// of a queue. Call Run to start processing.
+func NewQueueConsumer[T any](queue *TypedQueue[T], handler QueueHandler[T], options *QueueConsumerOptions) *QueueConsumer[T] {
+	if options == nil {
+		options = &QueueConsumerOptions{}
+	}
+	opts := *options
+	if len(opts.Partitions) == 0 {
+		opts.Partitions = []string{""}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = queueConsumerDefaultMaxRetries
+	}
+	if opts.PollTimeout <= 0 {
+		opts.PollTimeout = queueConsumerDefaultPollTimeout
+	}
+	return &QueueConsumer[T]{queue: queue, handler: handler, options: opts}
+}
+
+// Run processes items until ctx is cancelled, then stops getting new items
+// and returns once the items in progress are handled. Handlers receive a
+// context that is not cancelled with ctx, so they can finish their work.
+func (c *QueueConsumer[T]) Run(ctx context.Context) error {
+	for _, partition := range c.options.Partitions {
+		if _, err := validatePartitionKey(partition); err != nil {
+			return err
+		}
+	}
+	c.started.Store(time.Now().UnixNano())
+
+	handlerCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+	for i := range c.options.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(ctx, handlerCtx, i)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// work gets and handles items one at a time, cycling through the partitions
+// starting at a different one for each worker.
+func (c *QueueConsumer[T]) work(ctx, handlerCtx context.Context, worker int) {
+	partitions := c.options.Partitions
+	pollTimeout := max(c.options.PollTimeout/time.Duration(len(partitions)), time.Second)
+	backoff := queueInitialPutBackoff
+	for i := worker; ctx.Err() == nil; i++ {
+		partition := partitions[i%len(partitions)]
+		values, err := c.queue.Queue.getRaw(1, &QueueGetOptions{Timeout: &pollTimeout, Partition: partition})
+		var emptyErr QueueEmptyError
+		if errors.As(err, &emptyErr) {
+			continue
+		}
+		if err != nil {
+			c.reportError(fmt.Errorf("get from queue %s: %w", c.queue.Queue.QueueId, err))
+			if sleepCtx(ctx, backoff) != nil {
+				return
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+		backoff = queueInitialPutBackoff
+		c.handle(handlerCtx, partition, values[0])
+	}
+}
+
+// handle processes an item, retrying or dead-lettering it on failure.
+func (c *QueueConsumer[T]) handle(ctx context.Context, partition string, data []byte) {
+	retries, data := unwrapQueueRetry(data)
+	item, err := c.queue.decode(data)
+	if err != nil {
+		c.reportError(err)
+		c.deadLetter(data)
+		return
+	}
+
+	if err := c.callHandler(ctx, item); err != nil {
+		c.failed.Add(1)
+		c.reportError(err)
+		if c.options.MaxRetries < 0 || retries >= c.options.MaxRetries {
+			c.deadLetter(data)
+			return
+		}
+		wrapped, err := wrapQueueRetry(retries+1, data)
+		if err == nil {
+			err = c.queue.Queue.putRaw([][]byte{wrapped}, &QueuePutOptions{Partition: partition})
+		}
+		if err != nil {
+			c.reportError(fmt.Errorf("re-enqueue failed item: %w", err))
+			c.deadLetter(data)
+			return
+		}
+		c.retried.Add(1)
+		return
+	}
+	c.processed.Add(1)
+}
+
+func (c *QueueConsumer[T]) callHandler(ctx context.Context, item T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("queue handler panicked: %v", r)
+		}
+	}()
+	return c.handler(ctx, item)
+}
+
+// deadLetter moves an item to the dead-letter queue, if any.
+func (c *QueueConsumer[T]) deadLetter(data []byte) {
+	c.deadLettered.Add(1)
+	if c.options.DeadLetter == nil {
+		return
+	}
+	if err := c.options.DeadLetter.putRaw([][]byte{data}, nil); err != nil {
+		c.reportError(fmt.Errorf("put to dead-letter queue %s: %w", c.options.DeadLetter.QueueId, err))
+	}
+}
+
+func (c *QueueConsumer[T]) reportError(err error) {
+	if c.options.OnError != nil {
+		c.options.OnError(err)
+	}
+}
+
+// Stats returns the counters of the consumer, and the number of pending items
+// in the consumed partitions from Queue.Len.
+func (c *QueueConsumer[T]) Stats() (QueueConsumerStats, error) {
+	stats := QueueConsumerStats{
+		Processed:    c.processed.Load(),
+		Failed:       c.failed.Load(),
+		Retried:      c.retried.Load(),
+		DeadLettered: c.deadLettered.Load(),
+	}
+	if started := c.started.Load(); started != 0 {
+		if elapsed := time.Since(time.Unix(0, started)).Seconds(); elapsed > 0 {
+			stats.Throughput = float64(stats.Processed) / elapsed
+		}
+	}
+	for _, partition := range c.options.Partitions {
+		n, err := c.queue.Queue.Len(&QueueLenOptions{Partition: partition})
+		if err != nil {
+			return stats, err
+		}
+		stats.Pending += n
+	}
+	return stats, nil
+}
+
+// wrapQueueRetry wraps an encoded item with its retry count.
+func wrapQueueRetry(retries int, data []byte) ([]byte, error) {
+	b, err := pickleSerialize(map[any]any{
+		queueRetryKey: int64(retries),
+		"item":        pickle.Bytes(data),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// unwrapQueueRetry returns the retry count and encoded item of an item that
+// may have been wrapped by wrapQueueRetry.
+func unwrapQueueRetry(data []byte) (int, []byte) {
+	// Pickles of protocol 2 and later start with the PROTO opcode.
+	if len(data) == 0 || data[0] != 0x80 {
+		return 0, data
+	}
+	v, err := pickleDeserialize(data)
+	if err != nil {
+		return 0, data
+	}
+	m, ok := v.(map[any]any)
+	if !ok || len(m) != 2 {
+		return 0, data
+	}
+	retries, ok := m[queueRetryKey].(int64)
+	item, ok2 := m["item"].(pickle.Bytes)
+	if !ok || !ok2 {
+		return 0, data
+	}
+	return int(retries), []byte(item)
+}
@@ -0,0 +1,48 @@
+package modal
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestQueueRetryEnvelope(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	item, err := PickleCodec[string]().Encode("job-1")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	retries, data := unwrapQueueRetry(item)
+	g.Expect(retries).Should(gomega.Equal(0))
+	g.Expect(data).Should(gomega.Equal(item))
+
+	wrapped, err := wrapQueueRetry(2, item)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	retries, data = unwrapQueueRetry(wrapped)
+	g.Expect(retries).Should(gomega.Equal(2))
+	g.Expect(data).Should(gomega.Equal(item))
+
+	// Items of other codecs are never mistaken for retries.
+	jsonItem := []byte(`{"__modal_queue_retry__": 1, "item": "x"}`)
+	retries, data = unwrapQueueRetry(jsonItem)
+	g.Expect(retries).Should(gomega.Equal(0))
+	g.Expect(data).Should(gomega.Equal(jsonItem))
+
+	// A user dict with other keys is not a retry either.
+	dict, err := pickleSerialize(map[any]any{"item": "x", "other": int64(1)})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	retries, _ = unwrapQueueRetry(dict.Bytes())
+	g.Expect(retries).Should(gomega.Equal(0))
+}
+
+func TestNewQueueConsumerDefaults(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	c := NewQueueConsumer(QueueOf[string](&Queue{}, nil), nil, nil)
+	g.Expect(c.options.Partitions).Should(gomega.Equal([]string{""}))
+	g.Expect(c.options.Concurrency).Should(gomega.Equal(1))
+	g.Expect(c.options.MaxRetries).Should(gomega.Equal(queueConsumerDefaultMaxRetries))
+	g.Expect(c.options.PollTimeout).Should(gomega.Equal(queueConsumerDefaultPollTimeout))
+}
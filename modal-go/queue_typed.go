@@ -0,0 +1,106 @@
+package modal
+
+// queue_typed.go implements Queues of typed items.
+
+import (
+	"errors"
+	"iter"
+)
+
+// TypedQueue is a Queue of items of type T, which are encoded with a
+// QueueCodec.
+type TypedQueue[T any] struct {
+	Queue *Queue
+	codec QueueCodec[T]
+}
+
+// QueueOf returns a TypedQueue that reads and writes items of type T in a
+// Queue. If codec is nil, items are stored as Python pickles like Queue
+// does, see PickleCodec.
+func QueueOf[T any](q *Queue, codec QueueCodec[T]) *TypedQueue[T] {
+	if codec == nil {
+		codec = PickleCodec[T]()
+	}
+	return &TypedQueue[T]{Queue: q, codec: codec}
+}
+
+// Put adds a single item to the end of the queue, see Queue.Put.
+func (q *TypedQueue[T]) Put(v T, options *QueuePutOptions) error {
+	return q.PutMany([]T{v}, options)
+}
+
+// PutMany adds multiple items to the end of the queue, see Queue.PutMany.
+func (q *TypedQueue[T]) PutMany(values []T, options *QueuePutOptions) error {
+	encoded := make([][]byte, len(values))
+	for i, v := range values {
+		data, err := q.codec.Encode(v)
+		if err != nil {
+			return err
+		}
+		encoded[i] = data
+	}
+	return q.Queue.putRaw(encoded, options)
+}
+
+// Get removes and returns one item, see Queue.Get.
+//
+// Returns QueueDecodeError if the item could not be decoded. The item is
+// removed from the queue regardless.
+func (q *TypedQueue[T]) Get(options *QueueGetOptions) (T, error) {
+	var zero T
+	values, err := q.Queue.getRaw(1, options)
+	if err != nil {
+		return zero, err
+	}
+	return q.decode(values[0])
+}
+
+// GetMany removes up to n items, see Queue.GetMany.
+//
+// Items that could not be decoded are left out of the result, and reported
+// as QueueDecodeError, joined with errors.Join. They are removed from the
+// queue regardless, and their encoded data is kept in the errors.
+func (q *TypedQueue[T]) GetMany(n int, options *QueueGetOptions) ([]T, error) {
+	values, err := q.Queue.getRaw(n, options)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]T, 0, len(values))
+	var errs []error
+	for _, data := range values {
+		v, err := q.decode(data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out, errors.Join(errs...)
+}
+
+// Iterate yields items from the queue until it is empty, see Queue.Iterate.
+//
+// Items that could not be decoded are yielded as QueueDecodeError, and
+// iteration continues with the next item.
+func (q *TypedQueue[T]) Iterate(options *QueueIterateOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		for item, err := range q.Queue.iterateRaw(options) {
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(q.decode(item.data)) {
+				return
+			}
+		}
+	}
+}
+
+func (q *TypedQueue[T]) decode(data []byte) (T, error) {
+	v, err := q.codec.Decode(data)
+	if err != nil {
+		return v, QueueDecodeError{Data: data, Err: err}
+	}
+	return v, nil
+}
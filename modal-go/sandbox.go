@@ -1,15 +1,14 @@
 package modal
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"iter"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/djherbis/buffer"
-	"github.com/djherbis/nio/v3"
 	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -37,6 +36,8 @@ type ExecOptions struct {
 	Timeout time.Duration
 	// Secrets with environment variables for the command.
 	Secrets []*Secret
+	// Mode selects text or binary output. Defaults to StreamModeBinary.
+	Mode StreamMode
 }
 
 // Tunnel represents a port forwarded from within a running Modal sandbox.
@@ -68,28 +69,72 @@ func (t *Tunnel) TCPSocket() (string, int, error) {
 	return t.UnencryptedHost, t.UnencryptedPort, nil
 }
 
+// SandboxState is the lifecycle state of a Sandbox, as reported by SandboxList.
+type SandboxState string
+
+const (
+	// SandboxStatePending means the Sandbox has been created but has not started running yet.
+	SandboxStatePending SandboxState = "pending"
+	// SandboxStateRunning means the Sandbox is currently running.
+	SandboxStateRunning SandboxState = "running"
+	// SandboxStateFinished means the Sandbox has exited.
+	SandboxStateFinished SandboxState = "finished"
+)
+
 // Sandbox represents a Modal sandbox, which can run commands and manage
 // input/output streams for a remote process.
 type Sandbox struct {
 	SandboxId string
 	Stdin     io.WriteCloser
-	Stdout    io.ReadCloser
-	Stderr    io.ReadCloser
-
-	ctx     context.Context
-	taskId  string
-	tunnels map[int]*Tunnel
+	Stdout    *OutputStream
+	Stderr    *OutputStream
+
+	// Metadata below is only populated for Sandboxes returned by SandboxList,
+	// except for AppId, which is also set by App.CreateSandbox.
+	AppId      string            // ID of the App the Sandbox belongs to.
+	CreatedAt  time.Time         // Time the Sandbox was created.
+	State      SandboxState      // Lifecycle state at the time of listing.
+	FinishedAt time.Time         // Time the Sandbox finished, if it had at the time of listing.
+	Tags       map[string]string // Tags set on the Sandbox with SetTags.
+
+	ctx context.Context
+
+	mu            sync.Mutex      // protects the fields below
+	taskId        string          // looked up on first use
+	tunnels       map[int]*Tunnel // looked up on first use
+	finished      bool            // terminated, or observed to have exited
+	watchErr      error           // error that watching for the exit failed with, if any
+	done          chan struct{}   // closed once finished
+	watchOnce     sync.Once       // starts watching for the exit of the Sandbox
+	stopOnCtxDone func() bool     // stops terminating on context cancellation
 }
 
 // newSandbox creates a new Sandbox object from ID.
 func newSandbox(ctx context.Context, sandboxId string) *Sandbox {
-	sb := &Sandbox{SandboxId: sandboxId, ctx: ctx}
+	sb := &Sandbox{SandboxId: sandboxId, ctx: ctx, done: make(chan struct{})}
 	sb.Stdin = inputStreamSb(ctx, sandboxId)
-	sb.Stdout = outputStreamSb(ctx, sandboxId, pb.FileDescriptor_FILE_DESCRIPTOR_STDOUT)
-	sb.Stderr = outputStreamSb(ctx, sandboxId, pb.FileDescriptor_FILE_DESCRIPTOR_STDERR)
+	sb.Stdout = sb.OutputStream(FileDescriptorStdout, nil)
+	sb.Stderr = sb.OutputStream(FileDescriptorStderr, nil)
 	return sb
 }
 
+// OutputStream opens an output stream of the Sandbox. Use
+// OutputStreamOptions.LastEntryId to resume a stream that was read before,
+// e.g. by a previous run of the program.
+//
+// Modal sends the output of Sandboxes as text, so it is always valid UTF-8.
+// Reading the stream fails with InvalidError if options.Mode is set to any
+// other mode than StreamModeText.
+func (sb *Sandbox) OutputStream(fd FileDescriptor, options *OutputStreamOptions) *OutputStream {
+	if options == nil {
+		options = &OutputStreamOptions{}
+	}
+	if options.Mode != "" && options.Mode != StreamModeText {
+		return newFailedOutputStream(sb.ctx, InvalidError{fmt.Sprintf("stream mode %q is not supported for Sandbox output, which Modal sends as text", options.Mode)})
+	}
+	return newOutputStream(sb.ctx, sandboxOutputSource(sb.SandboxId, fd), options.LastEntryId)
+}
+
 // SandboxFromId returns a running Sandbox object from an ID.
 func SandboxFromId(ctx context.Context, sandboxId string) (*Sandbox, error) {
 	ctx, err := clientContext(ctx)
@@ -110,9 +155,164 @@ func SandboxFromId(ctx context.Context, sandboxId string) (*Sandbox, error) {
 	return newSandbox(ctx, sandboxId), nil
 }
 
+// SandboxListOptions are options for listing Sandboxes.
+type SandboxListOptions struct {
+	AppId           string            // Only list Sandboxes in this App.
+	Tags            map[string]string // Only list Sandboxes that have all of these tags.
+	IncludeFinished bool              // Also list Sandboxes that have already exited.
+	Environment     string            // Environment to list Sandboxes in.
+}
+
+// SandboxList lists Sandboxes, most recently created first.
+//
+// Results are fetched page by page as the sequence is consumed. Listing stops
+// at the first error, which is yielded to the caller. Sandboxes that had
+// finished when listed are known to be finished, so their Done channel is
+// closed and methods that need a running Sandbox fail without calling Modal.
+func SandboxList(ctx context.Context, options *SandboxListOptions) iter.Seq2[*Sandbox, error] {
+	if options == nil {
+		options = &SandboxListOptions{}
+	}
+
+	return func(yield func(*Sandbox, error) bool) {
+		ctx, err := clientContext(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for info, err := range listSandboxInfos(ctx, options) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(sandboxFromInfo(ctx, info), nil) {
+				return
+			}
+		}
+	}
+}
+
+// listSandboxInfos lists the SandboxList entries of Sandboxes, page by page.
+func listSandboxInfos(ctx context.Context, options *SandboxListOptions) iter.Seq2[*pb.SandboxInfo, error] {
+	return func(yield func(*pb.SandboxInfo, error) bool) {
+		var beforeTimestamp float64
+		for {
+			resp, err := client.SandboxList(ctx, pb.SandboxListRequest_builder{
+				AppId:           options.AppId,
+				BeforeTimestamp: beforeTimestamp,
+				EnvironmentName: environmentName(options.Environment),
+				IncludeFinished: options.IncludeFinished,
+				Tags:            sandboxTagsToProto(options.Tags),
+			}.Build())
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if len(resp.GetSandboxes()) == 0 {
+				return
+			}
+			for _, info := range resp.GetSandboxes() {
+				if !yield(info, nil) {
+					return
+				}
+			}
+			beforeTimestamp = resp.GetSandboxes()[len(resp.GetSandboxes())-1].GetCreatedAt()
+		}
+	}
+}
+
+// finishedAt looks up the time the finished Sandbox finished. Modal only
+// reports it when listing Sandboxes, so this searches the Sandboxes of its
+// App, or of the default environment if the App is not known. Returns the
+// zero time if the Sandbox is not found.
+func (sb *Sandbox) finishedAt() time.Time {
+	options := &SandboxListOptions{AppId: sb.AppId, IncludeFinished: true}
+	for info, err := range listSandboxInfos(sb.ctx, options) {
+		if err != nil {
+			return time.Time{}
+		}
+		if info.GetId() == sb.SandboxId {
+			return timeFromSeconds(info.GetTaskInfo().GetFinishedAt())
+		}
+	}
+	return time.Time{}
+}
+
+// sandboxFromInfo creates a Sandbox with metadata from a SandboxList entry.
+func sandboxFromInfo(ctx context.Context, info *pb.SandboxInfo) *Sandbox {
+	sb := newSandbox(ctx, info.GetId())
+	sb.AppId = info.GetAppId()
+	sb.CreatedAt = timeFromSeconds(info.GetCreatedAt())
+	sb.Tags = make(map[string]string, len(info.GetTags()))
+	for _, tag := range info.GetTags() {
+		sb.Tags[tag.GetTagName()] = tag.GetTagValue()
+	}
+
+	taskInfo := info.GetTaskInfo()
+	sb.FinishedAt = timeFromSeconds(taskInfo.GetFinishedAt())
+	switch {
+	case taskInfo.GetResult() != nil && taskInfo.GetResult().GetStatus() != pb.GenericResult_GENERIC_STATUS_UNSPECIFIED:
+		sb.State = SandboxStateFinished
+		sb.finish()
+	case taskInfo.GetStartedAt() != 0:
+		sb.State = SandboxStateRunning
+	default:
+		sb.State = SandboxStatePending
+	}
+	return sb
+}
+
+// sandboxTagsToProto converts a tag map to a list of tags, sorted by name.
+func sandboxTagsToProto(tags map[string]string) []*pb.SandboxTag {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tagsList := make([]*pb.SandboxTag, 0, len(names))
+	for _, name := range names {
+		tagsList = append(tagsList, pb.SandboxTag_builder{
+			TagName:  name,
+			TagValue: tags[name],
+		}.Build())
+	}
+	return tagsList
+}
+
+// timeFromSeconds converts a floating-point Unix timestamp to a time.Time.
+func timeFromSeconds(seconds float64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*1e9))
+}
+
+// SetTags sets tags (key-value pairs) on the Sandbox, replacing any existing
+// tags. Tags can be used to filter results in SandboxList.
+func (sb *Sandbox) SetTags(tags map[string]string) error {
+	if err := sb.checkRunning(); err != nil {
+		return err
+	}
+	_, err := client.SandboxTagsSet(sb.ctx, pb.SandboxTagsSetRequest_builder{
+		EnvironmentName: environmentName(""),
+		SandboxId:       sb.SandboxId,
+		Tags:            sandboxTagsToProto(tags),
+	}.Build())
+	if err != nil {
+		return err
+	}
+	sb.Tags = make(map[string]string, len(tags))
+	for name, value := range tags {
+		sb.Tags[name] = value
+	}
+	return nil
+}
+
 // Exec runs a command in the sandbox and returns text streams.
 func (sb *Sandbox) Exec(command []string, opts ExecOptions) (*ContainerProcess, error) {
-	if err := sb.ensureTaskId(); err != nil {
+	taskId, err := sb.ensureTaskId()
+	if err != nil {
 		return nil, err
 	}
 	var workdir *string
@@ -127,7 +327,7 @@ func (sb *Sandbox) Exec(command []string, opts ExecOptions) (*ContainerProcess,
 	}
 
 	resp, err := client.ContainerExec(sb.ctx, pb.ContainerExecRequest_builder{
-		TaskId:      sb.taskId,
+		TaskId:      taskId,
 		Command:     command,
 		Workdir:     workdir,
 		TimeoutSecs: uint32(opts.Timeout.Seconds()),
@@ -143,7 +343,8 @@ func (sb *Sandbox) Exec(command []string, opts ExecOptions) (*ContainerProcess,
 // The mode parameter follows the same conventions as os.OpenFile:
 // "r" for read-only, "w" for write-only (truncates), "a" for append, etc.
 func (sb *Sandbox) Open(path, mode string) (*SandboxFile, error) {
-	if err := sb.ensureTaskId(); err != nil {
+	taskId, err := sb.ensureTaskId()
+	if err != nil {
 		return nil, err
 	}
 
@@ -152,7 +353,7 @@ func (sb *Sandbox) Open(path, mode string) (*SandboxFile, error) {
 			Path: path,
 			Mode: mode,
 		}.Build(),
-		TaskId: sb.taskId,
+		TaskId: taskId,
 	}.Build(), nil)
 
 	if err != nil {
@@ -161,58 +362,216 @@ func (sb *Sandbox) Open(path, mode string) (*SandboxFile, error) {
 
 	return &SandboxFile{
 		fileDescriptor: resp.GetFileDescriptor(),
-		taskId:         sb.taskId,
+		taskId:         taskId,
 		ctx:            sb.ctx,
 	}, nil
 }
 
-func (sb *Sandbox) ensureTaskId() error {
-	if sb.taskId == "" {
-		resp, err := client.SandboxGetTaskId(sb.ctx, pb.SandboxGetTaskIdRequest_builder{
-			SandboxId: sb.SandboxId,
-		}.Build())
-		if err != nil {
-			return err
-		}
-		if resp.GetTaskId() == "" {
-			return fmt.Errorf("Sandbox %s does not have a task ID, it may not be running", sb.SandboxId)
-		}
-		if resp.GetTaskResult() != nil {
-			return fmt.Errorf("Sandbox %s has already completed with result: %v", sb.SandboxId, resp.GetTaskResult())
-		}
-		sb.taskId = resp.GetTaskId()
+// ensureTaskId returns the task ID of the running sandbox, looking it up on
+// first use.
+func (sb *Sandbox) ensureTaskId() (string, error) {
+	sb.mu.Lock()
+	finished, taskId := sb.finished, sb.taskId
+	sb.mu.Unlock()
+	if finished {
+		return "", sb.checkRunning()
 	}
-	return nil
+	if taskId != "" {
+		return taskId, nil
+	}
+
+	resp, err := client.SandboxGetTaskId(sb.ctx, pb.SandboxGetTaskIdRequest_builder{
+		SandboxId: sb.SandboxId,
+	}.Build())
+	if err != nil {
+		return "", err
+	}
+	if resp.GetTaskId() == "" {
+		return "", fmt.Errorf("Sandbox %s does not have a task ID, it may not be running", sb.SandboxId)
+	}
+	if result := sandboxResultFromProto(resp.GetTaskResult()); result != nil {
+		sb.finish()
+		return "", SandboxTerminatedError{Exception: fmt.Sprintf("Sandbox %s has already finished with status %s", sb.SandboxId, result.Status)}
+	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.finished {
+		return "", SandboxTerminatedError{Exception: fmt.Sprintf("Sandbox %s is no longer running", sb.SandboxId)}
+	}
+	sb.taskId = resp.GetTaskId()
+	return sb.taskId, nil
 }
 
-// Terminate stops the sandbox.
+// Terminate stops the sandbox. Terminating a sandbox that was already
+// terminated or has exited does nothing.
 func (sb *Sandbox) Terminate() error {
-	_, err := client.SandboxTerminate(sb.ctx, pb.SandboxTerminateRequest_builder{
+	return sb.terminate(sb.ctx)
+}
+
+func (sb *Sandbox) terminate(ctx context.Context) error {
+	sb.mu.Lock()
+	finished := sb.finished
+	sb.mu.Unlock()
+	if finished {
+		return nil
+	}
+
+	// The lock is not held during the request, so that other methods are not
+	// blocked by it. Terminating twice concurrently is harmless.
+	_, err := client.SandboxTerminate(ctx, pb.SandboxTerminateRequest_builder{
 		SandboxId: sb.SandboxId,
 	}.Build())
 	if err != nil {
 		return err
 	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
 	sb.taskId = ""
+	sb.finishLocked()
+	return nil
+}
+
+// terminateTimeout bounds the termination of a sandbox after its context was
+// cancelled.
+const terminateTimeout = 30 * time.Second
+
+// terminateOnContextDone terminates the sandbox once ctx is cancelled, unless
+// it finishes first.
+func (sb *Sandbox) terminateOnContextDone(ctx context.Context) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.stopOnCtxDone = context.AfterFunc(ctx, func() {
+		// ctx is already cancelled, but still carries the client credentials.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), terminateTimeout)
+		defer cancel()
+		_ = sb.terminate(ctx)
+	})
+}
+
+// Done returns a channel that is closed when the sandbox exits or is
+// terminated.
+//
+// The exit is observed in the background with the context of the sandbox.
+// If that fails, for example because the context is cancelled, the channel
+// is closed too, and Err returns the error.
+func (sb *Sandbox) Done() <-chan struct{} {
+	sb.watchOnce.Do(func() {
+		go sb.watch()
+	})
+	return sb.done
+}
+
+// Err returns the error that observing the exit of the sandbox failed with,
+// once Done is closed because of it, or nil otherwise.
+func (sb *Sandbox) Err() error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.watchErr
+}
+
+// watch waits for the sandbox to exit, retrying transient errors.
+func (sb *Sandbox) watch() {
+	backoff := outputStreamInitialBackoff
+	for {
+		select {
+		case <-sb.done:
+			return
+		default:
+		}
+		_, err := sb.wait()
+		if err == nil {
+			return
+		}
+		if !isRetryableGrpc(err) {
+			sb.finishWithError(err)
+			return
+		}
+		if err := sleepCtx(sb.ctx, backoff); err != nil {
+			sb.finishWithError(err)
+			return
+		}
+		backoff = min(backoff*2, outputStreamMaxBackoff)
+	}
+}
+
+// checkRunning returns SandboxTerminatedError if the sandbox is known to have
+// been terminated or to have exited.
+func (sb *Sandbox) checkRunning() error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.finished {
+		return SandboxTerminatedError{Exception: fmt.Sprintf("Sandbox %s is no longer running", sb.SandboxId)}
+	}
 	return nil
 }
 
-// Wait blocks until the sandbox exits.
+// finish records that the sandbox is no longer running.
+func (sb *Sandbox) finish() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.finishLocked()
+}
+
+// finishWithError records that the sandbox is no longer watched because of
+// err, unless it finished before.
+func (sb *Sandbox) finishWithError(err error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if !sb.finished {
+		sb.watchErr = err
+	}
+	sb.finishLocked()
+}
+
+func (sb *Sandbox) finishLocked() {
+	if sb.finished {
+		return
+	}
+	sb.finished = true
+	close(sb.done)
+	if sb.stopOnCtxDone != nil {
+		sb.stopOnCtxDone()
+	}
+}
+
+// Wait blocks until the sandbox exits and returns its exit code.
+//
+// Timeouts and terminations are reported as exit codes 124 and 137
+// respectively. Use WaitResult to tell them apart from real exit codes.
 func (sb *Sandbox) Wait() (int, error) {
+	result, err := sb.wait()
+	if err != nil {
+		return 0, err
+	}
+	return result.returnCode(), nil
+}
+
+// WaitResult blocks until the sandbox exits and returns how it finished. The
+// finish time is looked up by listing the Sandboxes of its App.
+func (sb *Sandbox) WaitResult() (*SandboxResult, error) {
+	result, err := sb.wait()
+	if err != nil {
+		return nil, err
+	}
+	result.FinishedAt = sb.finishedAt()
+	return result, nil
+}
+
+// wait is like WaitResult, without looking up the finish time.
+func (sb *Sandbox) wait() (*SandboxResult, error) {
 	for {
 		resp, err := client.SandboxWait(sb.ctx, pb.SandboxWaitRequest_builder{
 			SandboxId: sb.SandboxId,
 			Timeout:   55,
 		}.Build())
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		if resp.GetResult() != nil {
-			returnCode := getReturnCode(resp.GetResult())
-			if returnCode != nil {
-				return *returnCode, nil
-			}
-			return 0, nil
+		if result := sandboxResultFromProto(resp.GetResult()); result != nil {
+			sb.finish()
+			return result, nil
 		}
 	}
 }
@@ -221,8 +580,14 @@ func (sb *Sandbox) Wait() (int, error) {
 // Returns SandboxTimeoutError if the tunnels are not available after the timeout.
 // Returns a map of Tunnel objects keyed by the container port.
 func (sb *Sandbox) Tunnels(timeout time.Duration) (map[int]*Tunnel, error) {
-	if sb.tunnels != nil {
-		return sb.tunnels, nil
+	if err := sb.checkRunning(); err != nil {
+		return nil, err
+	}
+	sb.mu.Lock()
+	tunnels := sb.tunnels
+	sb.mu.Unlock()
+	if tunnels != nil {
+		return tunnels, nil
 	}
 
 	resp, err := client.SandboxGetTunnels(sb.ctx, pb.SandboxGetTunnelsRequest_builder{
@@ -237,9 +602,9 @@ func (sb *Sandbox) Tunnels(timeout time.Duration) (map[int]*Tunnel, error) {
 		return nil, SandboxTimeoutError{Exception: "Sandbox operation timed out"}
 	}
 
-	sb.tunnels = make(map[int]*Tunnel)
+	tunnels = make(map[int]*Tunnel)
 	for _, t := range resp.GetTunnels() {
-		sb.tunnels[int(t.GetContainerPort())] = &Tunnel{
+		tunnels[int(t.GetContainerPort())] = &Tunnel{
 			Host:            t.GetHost(),
 			Port:            int(t.GetPort()),
 			UnencryptedHost: t.GetUnencryptedHost(),
@@ -247,12 +612,21 @@ func (sb *Sandbox) Tunnels(timeout time.Duration) (map[int]*Tunnel, error) {
 		}
 	}
 
+	// Concurrent callers may have looked up the tunnels too, keep the first.
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.tunnels == nil {
+		sb.tunnels = tunnels
+	}
 	return sb.tunnels, nil
 }
 
 // Snapshot the filesystem of the Sandbox.
 // Returns an Image object which can be used to spawn a new Sandbox with the same filesystem.
 func (sb *Sandbox) SnapshotFilesystem(timeout time.Duration) (*Image, error) {
+	if err := sb.checkRunning(); err != nil {
+		return nil, err
+	}
 	resp, err := client.SandboxSnapshotFs(sb.ctx, pb.SandboxSnapshotFsRequest_builder{
 		SandboxId: sb.SandboxId,
 		Timeout:   float32(timeout.Seconds()),
@@ -272,9 +646,76 @@ func (sb *Sandbox) SnapshotFilesystem(timeout time.Duration) (*Image, error) {
 	return &Image{ImageId: resp.GetImageId(), ctx: sb.ctx}, nil
 }
 
+// SandboxResourceUsage is the resources consumed by a Sandbox so far.
+//
+// CPU and memory usage are integrated over time, so a Sandbox using 2 cores
+// for one minute has a CPUCoreTime of two minutes.
+type SandboxResourceUsage struct {
+	CPUCoreTime   time.Duration // CPU time, summed over all cores.
+	MemoryGiBTime time.Duration // Memory usage in GiB, integrated over time.
+	GPUTime       time.Duration // GPU time, summed over all GPUs.
+	GPUType       string        // Type of GPU attached to the Sandbox, if any.
+}
+
+// CPUCoreHours returns the CPU usage in core-hours.
+func (u SandboxResourceUsage) CPUCoreHours() float64 {
+	return u.CPUCoreTime.Hours()
+}
+
+// MemoryGiBHours returns the memory usage in GiB-hours.
+func (u SandboxResourceUsage) MemoryGiBHours() float64 {
+	return u.MemoryGiBTime.Hours()
+}
+
+// GPUHours returns the GPU usage in GPU-hours.
+func (u SandboxResourceUsage) GPUHours() float64 {
+	return u.GPUTime.Hours()
+}
+
+// ResourceUsage returns the resources consumed by the Sandbox so far.
+func (sb *Sandbox) ResourceUsage() (*SandboxResourceUsage, error) {
+	resp, err := client.SandboxGetResourceUsage(sb.ctx, pb.SandboxGetResourceUsageRequest_builder{
+		SandboxId: sb.SandboxId,
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+	return &SandboxResourceUsage{
+		CPUCoreTime:   time.Duration(resp.GetCpuCoreNanosecs()),
+		MemoryGiBTime: time.Duration(resp.GetMemGibNanosecs()),
+		GPUTime:       time.Duration(resp.GetGpuNanosecs()),
+		GPUType:       resp.GetGpuType(),
+	}, nil
+}
+
 // Poll checks if the Sandbox has finished running.
 // Returns nil if the Sandbox is still running, else returns the exit code.
+//
+// Timeouts and terminations are reported as exit codes 124 and 137
+// respectively. Use PollResult to tell them apart from real exit codes.
 func (sb *Sandbox) Poll() (*int, error) {
+	result, err := sb.poll()
+	if err != nil || result == nil {
+		return nil, err
+	}
+	returnCode := result.returnCode()
+	return &returnCode, nil
+}
+
+// PollResult checks if the Sandbox has finished running.
+// Returns nil if the Sandbox is still running, else returns how it finished,
+// with the finish time looked up like in WaitResult.
+func (sb *Sandbox) PollResult() (*SandboxResult, error) {
+	result, err := sb.poll()
+	if err != nil || result == nil {
+		return nil, err
+	}
+	result.FinishedAt = sb.finishedAt()
+	return result, nil
+}
+
+// poll is like PollResult, without looking up the finish time.
+func (sb *Sandbox) poll() (*SandboxResult, error) {
 	resp, err := client.SandboxWait(sb.ctx, pb.SandboxWaitRequest_builder{
 		SandboxId: sb.SandboxId,
 		Timeout:   0,
@@ -283,26 +724,77 @@ func (sb *Sandbox) Poll() (*int, error) {
 		return nil, err
 	}
 
-	return getReturnCode(resp.GetResult()), nil
+	result := sandboxResultFromProto(resp.GetResult())
+	if result != nil {
+		sb.finish()
+	}
+	return result, nil
 }
 
-func getReturnCode(result *pb.GenericResult) *int {
-	if result == nil || result.GetStatus() == pb.GenericResult_GENERIC_STATUS_UNSPECIFIED {
-		return nil
-	}
+// SandboxStatus describes how a Sandbox finished.
+type SandboxStatus string
 
-	// Statuses are converted to exitcodes so we can conform to subprocess API.
-	var exitCode int
+const (
+	// SandboxStatusSuccess means the Sandbox command exited with code 0.
+	SandboxStatusSuccess SandboxStatus = "success"
+	// SandboxStatusFailure means the Sandbox command exited with a non-zero code.
+	SandboxStatusFailure SandboxStatus = "failure"
+	// SandboxStatusTimeout means the Sandbox exceeded its timeout.
+	SandboxStatusTimeout SandboxStatus = "timeout"
+	// SandboxStatusTerminated means the Sandbox was terminated, e.g. by Terminate.
+	SandboxStatusTerminated SandboxStatus = "terminated"
+	// SandboxStatusInitFailure means the Sandbox failed to start.
+	SandboxStatusInitFailure SandboxStatus = "init_failure"
+	// SandboxStatusInternalFailure means the Sandbox failed due to an internal error in Modal.
+	SandboxStatusInternalFailure SandboxStatus = "internal_failure"
+)
+
+// SandboxResult describes how a Sandbox finished.
+type SandboxResult struct {
+	Status     SandboxStatus
+	ExitCode   int       // Exit code of the Sandbox command, as reported by Modal.
+	Exception  string    // Error message, if the Sandbox did not finish successfully.
+	FinishedAt time.Time // Time the Sandbox finished, as reported by Modal. Zero if it could not be looked up.
+}
+
+// sandboxResultFromProto converts the result of a Sandbox, or returns nil if
+// the Sandbox has not finished.
+func sandboxResultFromProto(result *pb.GenericResult) *SandboxResult {
+	var status SandboxStatus
 	switch result.GetStatus() {
+	case pb.GenericResult_GENERIC_STATUS_UNSPECIFIED:
+		return nil
+	case pb.GenericResult_GENERIC_STATUS_SUCCESS:
+		status = SandboxStatusSuccess
 	case pb.GenericResult_GENERIC_STATUS_TIMEOUT:
-		exitCode = 124
+		status = SandboxStatusTimeout
 	case pb.GenericResult_GENERIC_STATUS_TERMINATED:
-		exitCode = 137
+		status = SandboxStatusTerminated
+	case pb.GenericResult_GENERIC_STATUS_INIT_FAILURE:
+		status = SandboxStatusInitFailure
+	case pb.GenericResult_GENERIC_STATUS_INTERNAL_FAILURE:
+		status = SandboxStatusInternalFailure
 	default:
-		exitCode = int(result.GetExitcode())
+		status = SandboxStatusFailure
+	}
+
+	return &SandboxResult{
+		Status:    status,
+		ExitCode:  int(result.GetExitcode()),
+		Exception: result.GetException(),
 	}
+}
 
-	return &exitCode
+// returnCode converts the result to an exit code, so we can conform to the subprocess API.
+func (r *SandboxResult) returnCode() int {
+	switch r.Status {
+	case SandboxStatusTimeout:
+		return 124
+	case SandboxStatusTerminated:
+		return 137
+	default:
+		return r.ExitCode
+	}
 }
 
 // ContainerProcess represents a process running in a Modal container, allowing
@@ -311,11 +803,13 @@ func getReturnCode(result *pb.GenericResult) *int {
 // It is created by executing a command in a sandbox.
 type ContainerProcess struct {
 	Stdin  io.WriteCloser
-	Stdout io.ReadCloser
-	Stderr io.ReadCloser
+	Stdout *OutputStream
+	Stderr *OutputStream
 
 	ctx    context.Context
 	execId string
+	mode   StreamMode
+	stdin  *cpStdin
 }
 
 func newContainerProcess(ctx context.Context, execId string, opts ExecOptions) *ContainerProcess {
@@ -328,23 +822,39 @@ func newContainerProcess(ctx context.Context, execId string, opts ExecOptions) *
 		stderrBehavior = opts.Stderr
 	}
 
-	cp := &ContainerProcess{execId: execId, ctx: ctx}
-	cp.Stdin = inputStreamCp(ctx, execId)
+	cp := &ContainerProcess{execId: execId, ctx: ctx, mode: opts.Mode}
+	cp.stdin = inputStreamCp(ctx, execId)
+	cp.Stdin = cp.stdin
 
-	cp.Stdout = outputStreamCp(ctx, execId, pb.FileDescriptor_FILE_DESCRIPTOR_STDOUT)
-	if stdoutBehavior == Ignore {
-		cp.Stdout.Close()
-		cp.Stdout = io.NopCloser(bytes.NewReader(nil))
+	cp.Stdout = newOutputStream(ctx, nil, "")
+	if stdoutBehavior != Ignore {
+		cp.Stdout = cp.OutputStream(FileDescriptorStdout, nil)
 	}
-	cp.Stderr = outputStreamCp(ctx, execId, pb.FileDescriptor_FILE_DESCRIPTOR_STDERR)
-	if stderrBehavior == Ignore {
-		cp.Stderr.Close()
-		cp.Stderr = io.NopCloser(bytes.NewReader(nil))
+	cp.Stderr = newOutputStream(ctx, nil, "")
+	if stderrBehavior != Ignore {
+		cp.Stderr = cp.OutputStream(FileDescriptorStderr, nil)
 	}
 
 	return cp
 }
 
+// OutputStream opens an output stream of the process. Use
+// OutputStreamOptions.LastEntryId to resume a stream that was read before.
+func (cp *ContainerProcess) OutputStream(fd FileDescriptor, options *OutputStreamOptions) *OutputStream {
+	if options == nil {
+		options = &OutputStreamOptions{}
+	}
+	mode := options.Mode
+	if mode == "" {
+		mode = cp.mode
+	}
+	if mode != "" && mode != StreamModeText && mode != StreamModeBinary {
+		return newFailedOutputStream(cp.ctx, InvalidError{fmt.Sprintf("invalid stream mode %q", mode)})
+	}
+	source := withStreamMode(execOutputSource(cp.execId, fd), mode)
+	return newOutputStream(cp.ctx, source, options.LastEntryId)
+}
+
 // Wait blocks until the container process exits and returns its exit code.
 func (cp *ContainerProcess) Wait() (int, error) {
 	for {
@@ -400,139 +910,44 @@ func (s *sbStdin) Close() error {
 	return err
 }
 
-func inputStreamCp(ctx context.Context, execId string) io.WriteCloser {
+func inputStreamCp(ctx context.Context, execId string) *cpStdin {
 	return &cpStdin{execId: execId, messageIndex: 1, ctx: ctx}
 }
 
 type cpStdin struct {
-	execId       string
+	execId string
+	ctx    context.Context // context for the exec operations
+
+	mu           sync.Mutex // protects messageIndex
 	messageIndex uint64
-	ctx          context.Context // context for the exec operations
 }
 
 func (c *cpStdin) Write(p []byte) (n int, err error) {
-	_, err = client.ContainerExecPutInput(c.ctx, pb.ContainerExecPutInputRequest_builder{
-		ExecId: c.execId,
-		Input: pb.RuntimeInputMessage_builder{
-			Message:      p,
-			MessageIndex: c.messageIndex,
-		}.Build(),
-	}.Build())
-	if err != nil {
+	if err := c.send(c.ctx, p, false); err != nil {
 		return 0, err
 	}
-	c.messageIndex++
 	return len(p), nil
 }
 
 func (c *cpStdin) Close() error {
-	_, err := client.ContainerExecPutInput(c.ctx, pb.ContainerExecPutInputRequest_builder{
+	return c.send(c.ctx, nil, true)
+}
+
+// send writes one input message to the process, optionally ending its input.
+func (c *cpStdin) send(ctx context.Context, p []byte, eof bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := client.ContainerExecPutInput(ctx, pb.ContainerExecPutInputRequest_builder{
 		ExecId: c.execId,
 		Input: pb.RuntimeInputMessage_builder{
+			Message:      p,
 			MessageIndex: c.messageIndex,
-			Eof:          true,
+			Eof:          eof,
 		}.Build(),
 	}.Build())
-	return err
-}
-
-func outputStreamSb(ctx context.Context, sandboxId string, fd pb.FileDescriptor) io.ReadCloser {
-	pr, pw := nio.Pipe(buffer.New(64 * 1024))
-	go func() {
-		defer pw.Close()
-		lastIndex := "0-0"
-		completed := false
-		retries := 10
-		for !completed {
-			stream, err := client.SandboxGetLogs(ctx, pb.SandboxGetLogsRequest_builder{
-				SandboxId:      sandboxId,
-				FileDescriptor: fd,
-				Timeout:        55,
-				LastEntryId:    lastIndex,
-			}.Build())
-			if err != nil {
-				if isRetryableGrpc(err) && retries > 0 {
-					retries--
-					continue
-				}
-				pw.CloseWithError(fmt.Errorf("error getting output stream: %w", err))
-				return
-			}
-			for {
-				batch, err := stream.Recv()
-				if err != nil {
-					if err != io.EOF {
-						if isRetryableGrpc(err) && retries > 0 {
-							retries--
-						} else {
-							pw.CloseWithError(fmt.Errorf("error getting output stream: %w", err))
-							return
-						}
-					}
-					break // we need to retry, either from an EOF or gRPC error
-				}
-				lastIndex = batch.GetEntryId()
-				for _, item := range batch.GetItems() {
-					// On error, writer has been closed. Still consume the rest of the channel.
-					pw.Write([]byte(item.GetData()))
-				}
-				if batch.GetEof() {
-					completed = true
-					break
-				}
-			}
-		}
-	}()
-	return pr
-}
-
-func outputStreamCp(ctx context.Context, execId string, fd pb.FileDescriptor) io.ReadCloser {
-	pr, pw := nio.Pipe(buffer.New(64 * 1024))
-	go func() {
-		defer pw.Close()
-		var lastIndex uint64
-		completed := false
-		retries := 10
-		for !completed {
-			stream, err := client.ContainerExecGetOutput(ctx, pb.ContainerExecGetOutputRequest_builder{
-				ExecId:         execId,
-				FileDescriptor: fd,
-				Timeout:        55,
-				GetRawBytes:    true,
-				LastBatchIndex: lastIndex,
-			}.Build())
-			if err != nil {
-				if isRetryableGrpc(err) && retries > 0 {
-					retries--
-					continue
-				}
-				pw.CloseWithError(fmt.Errorf("error getting output stream: %w", err))
-				return
-			}
-			for {
-				batch, err := stream.Recv()
-				if err != nil {
-					if err != io.EOF {
-						if isRetryableGrpc(err) && retries > 0 {
-							retries--
-						} else {
-							pw.CloseWithError(fmt.Errorf("error getting output stream: %w", err))
-							return
-						}
-					}
-					break // we need to retry, either from an EOF or gRPC error
-				}
-				lastIndex = batch.GetBatchIndex()
-				for _, item := range batch.GetItems() {
-					// On error, writer has been closed. Still consume the rest of the channel.
-					pw.Write(item.GetMessageBytes())
-				}
-				if batch.HasExitCode() {
-					completed = true
-					break
-				}
-			}
-		}
-	}()
-	return pr
+	if err != nil {
+		return err
+	}
+	c.messageIndex++
+	return nil
 }
@@ -0,0 +1,329 @@
+package modal
+
+// A net.Conn over the stdin and stdout of a ContainerProcess.
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConnFlushInterval = 5 * time.Millisecond
+	defaultConnMaxBatchSize  = 1024 * 1024 // 1 MiB
+	connReadChunkSize        = 32 * 1024
+)
+
+// ProcessConnOptions are options for ContainerProcess.Conn.
+type ProcessConnOptions struct {
+	// FlushInterval is how long small writes are buffered so they can be sent
+	// together in one input message (default 5ms).
+	FlushInterval time.Duration
+	// MaxBatchSize is the size at which buffered writes are sent right away
+	// (default 1 MiB).
+	MaxBatchSize int
+}
+
+// ProcessConn is a duplex connection to a ContainerProcess, which writes to
+// its stdin and reads from its stdout. It implements net.Conn, so it can be
+// used with protocols such as JSON-RPC over stdio.
+//
+// Small writes are buffered and sent together after a short flush interval.
+// Writes are reported as successful once buffered; errors from sending them
+// are returned by later calls to Write, Flush, CloseWrite, or Close.
+type ProcessConn struct {
+	stdin         *cpStdin
+	stdout        io.ReadCloser
+	execId        string
+	flushInterval time.Duration
+	maxBatchSize  int
+
+	readMu   sync.Mutex // serializes Read, protects pending
+	pending  []byte
+	chunks   chan []byte
+	readErr  error // set before chunks is closed
+	closedCh chan struct{}
+
+	deadlineMu      sync.Mutex // protects the fields below
+	readDeadline    time.Time
+	writeDeadline   time.Time
+	deadlineChanged chan struct{}
+
+	writeMu     sync.Mutex // protects the fields below
+	buf         []byte
+	flushTimer  *time.Timer
+	writeErr    error
+	writeClosed bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Conn returns a duplex connection over the stdin and stdout of the process.
+// After calling Conn, Stdin and Stdout should not be used directly. The
+// connection reads stdout as raw bytes, regardless of ExecOptions.Mode.
+func (cp *ContainerProcess) Conn(options *ProcessConnOptions) *ProcessConn {
+	if options == nil {
+		options = &ProcessConnOptions{}
+	}
+	stdout := cp.Stdout
+	if stdout.source != nil {
+		stdout = cp.OutputStream(FileDescriptorStdout, &OutputStreamOptions{Mode: StreamModeBinary})
+	}
+	c := &ProcessConn{
+		stdin:           cp.stdin,
+		stdout:          stdout,
+		execId:          cp.execId,
+		flushInterval:   options.FlushInterval,
+		maxBatchSize:    options.MaxBatchSize,
+		chunks:          make(chan []byte),
+		closedCh:        make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}
+	if c.flushInterval <= 0 {
+		c.flushInterval = defaultConnFlushInterval
+	}
+	if c.maxBatchSize <= 0 {
+		c.maxBatchSize = defaultConnMaxBatchSize
+	}
+
+	go c.readLoop()
+	return c
+}
+
+// readLoop pumps stdout into chunks, so that Read can honor deadlines.
+func (c *ProcessConn) readLoop() {
+	for {
+		b := make([]byte, connReadChunkSize)
+		n, err := c.stdout.Read(b)
+		if n > 0 {
+			select {
+			case c.chunks <- b[:n]:
+			case <-c.closedCh:
+				return
+			}
+		}
+		if err != nil {
+			c.readErr = err
+			close(c.chunks)
+			return
+		}
+	}
+}
+
+// Read reads output of the process. It returns io.EOF after the process
+// closes its stdout.
+func (c *ProcessConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	for {
+		c.deadlineMu.Lock()
+		deadline := c.readDeadline
+		changed := c.deadlineChanged
+		c.deadlineMu.Unlock()
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(remaining)
+			timeout = timer.C
+		}
+
+		select {
+		case chunk, ok := <-c.chunks:
+			stopTimer(timer)
+			if !ok {
+				return 0, c.readErr
+			}
+			n := copy(p, chunk)
+			c.pending = chunk[n:]
+			return n, nil
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-changed:
+			stopTimer(timer) // deadline was updated, wait again
+		case <-c.closedCh:
+			stopTimer(timer)
+			return 0, net.ErrClosed
+		}
+	}
+}
+
+// Write buffers p to be sent to the stdin of the process.
+func (c *ProcessConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.writeClosed {
+		return 0, net.ErrClosed
+	}
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+	if deadline := c.getWriteDeadline(); !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.maxBatchSize {
+		if err := c.flushLocked(); err != nil {
+			return 0, err
+		}
+	} else if c.flushTimer == nil {
+		c.flushTimer = time.AfterFunc(c.flushInterval, c.timedFlush)
+	}
+	return len(p), nil
+}
+
+// Flush sends all buffered writes to the process.
+func (c *ProcessConn) Flush() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	return c.flushLocked()
+}
+
+// CloseWrite flushes buffered writes and closes the stdin of the process.
+// Output can still be read until the process closes its stdout.
+func (c *ProcessConn) CloseWrite() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writeClosed {
+		return nil
+	}
+	c.writeClosed = true
+	if c.writeErr != nil {
+		return c.writeErr
+	}
+	if err := c.flushLocked(); err != nil {
+		return err
+	}
+	ctx, cancel := c.writeContext()
+	defer cancel()
+	return c.stdin.send(ctx, nil, true)
+}
+
+// Close closes both directions of the connection. Blocked Reads return
+// net.ErrClosed.
+func (c *ProcessConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.CloseWrite()
+		close(c.closedCh)
+		c.stdout.Close()
+	})
+	return c.closeErr
+}
+
+func (c *ProcessConn) timedFlush() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.flushTimer = nil
+	if c.writeErr == nil {
+		c.writeErr = c.flushLocked()
+	}
+}
+
+// flushLocked sends the buffer as input messages of at most MaxBatchSize bytes.
+func (c *ProcessConn) flushLocked() error {
+	if c.flushTimer != nil {
+		c.flushTimer.Stop()
+		c.flushTimer = nil
+	}
+
+	ctx, cancel := c.writeContext()
+	defer cancel()
+	for len(c.buf) > 0 {
+		n := min(len(c.buf), c.maxBatchSize)
+		if err := c.stdin.send(ctx, c.buf[:n], false); err != nil {
+			c.writeErr = err
+			return err
+		}
+		c.buf = c.buf[n:]
+	}
+	c.buf = nil
+	return nil
+}
+
+// writeContext returns the context for sending input, bounded by the write deadline.
+func (c *ProcessConn) writeContext() (context.Context, context.CancelFunc) {
+	if deadline := c.getWriteDeadline(); !deadline.IsZero() {
+		return context.WithDeadline(c.stdin.ctx, deadline)
+	}
+	return context.WithCancel(c.stdin.ctx)
+}
+
+func (c *ProcessConn) getWriteDeadline() time.Time {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	return c.writeDeadline
+}
+
+// LocalAddr returns a placeholder address for the client side of the connection.
+func (c *ProcessConn) LocalAddr() net.Addr {
+	return processAddr("local")
+}
+
+// RemoteAddr returns the exec ID of the process.
+func (c *ProcessConn) RemoteAddr() net.Addr {
+	return processAddr(c.execId)
+}
+
+// SetDeadline sets both the read and write deadlines.
+func (c *ProcessConn) SetDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.notifyDeadlineLocked()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read calls, including blocked ones.
+func (c *ProcessConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.readDeadline = t
+	c.notifyDeadlineLocked()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for sending buffered writes.
+func (c *ProcessConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *ProcessConn) notifyDeadlineLocked() {
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// processAddr is the net.Addr of a ProcessConn.
+type processAddr string
+
+func (a processAddr) Network() string { return "modal-exec" }
+func (a processAddr) String() string  { return string(a) }
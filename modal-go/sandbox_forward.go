@@ -0,0 +1,170 @@
+package modal
+
+// Connecting to ports of a Sandbox through its Tunnels.
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tunnelLookupTimeout bounds waiting for the Tunnels of a Sandbox to be available.
+const tunnelLookupTimeout = 30 * time.Second
+
+// DialContext connects to a container port of the Sandbox through its Tunnel.
+//
+// The port of addr is the container port, and the host is ignored, so this
+// can be used as the DialContext of an http.Transport to send requests such
+// as "http://sandbox:8000/" to a server inside the Sandbox. The port must be
+// in EncryptedPorts or UnencryptedPorts of the Sandbox.
+func (sb *Sandbox) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, InvalidError{Exception: fmt.Sprintf("unsupported network %q for Sandbox %s", network, sb.SandboxId)}
+	}
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	containerPort, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, InvalidError{Exception: fmt.Sprintf("invalid port in address %q", addr)}
+	}
+
+	tunnel, err := sb.tunnel(containerPort)
+	if err != nil {
+		return nil, err
+	}
+	return dialTunnel(ctx, tunnel)
+}
+
+// PortForward forwards connections from a local address to a container port
+// of a Sandbox. It is created by Sandbox.Forward.
+type PortForward struct {
+	listener net.Listener
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup // accept loop and open connections
+}
+
+// Forward listens on a local address, such as "127.0.0.1:8080", and proxies
+// each connection to a container port of the Sandbox through its Tunnel, so
+// clients that only speak plain TCP can reach a server inside the Sandbox.
+//
+// Forwarding stops when the PortForward is closed.
+func (sb *Sandbox) Forward(localAddr string, containerPort int) (*PortForward, error) {
+	tunnel, err := sb.tunnel(containerPort)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(sb.ctx)
+	pf := &PortForward{listener: listener, ctx: ctx, cancel: cancel}
+	context.AfterFunc(ctx, func() { listener.Close() })
+
+	pf.wg.Add(1)
+	go func() {
+		defer pf.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // listener closed
+			}
+			pf.wg.Add(1)
+			go func() {
+				defer pf.wg.Done()
+				pf.handle(conn, tunnel)
+			}()
+		}
+	}()
+	return pf, nil
+}
+
+// Addr returns the local address that connections are accepted on.
+func (pf *PortForward) Addr() net.Addr {
+	return pf.listener.Addr()
+}
+
+// Close stops accepting connections and closes all forwarded connections.
+func (pf *PortForward) Close() error {
+	pf.cancel()
+	pf.wg.Wait()
+	return nil
+}
+
+func (pf *PortForward) handle(local net.Conn, tunnel *Tunnel) {
+	remote, err := dialTunnel(pf.ctx, tunnel)
+	if err != nil {
+		local.Close()
+		return
+	}
+	proxyConns(pf.ctx, local, remote)
+}
+
+// proxyConns copies data in both directions until both sides are done or ctx
+// is done, then closes both connections.
+func proxyConns(ctx context.Context, a, b net.Conn) {
+	stop := context.AfterFunc(ctx, func() {
+		a.Close()
+		b.Close()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(a, b)
+	}()
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(b, a)
+	}()
+	wg.Wait()
+	a.Close()
+	b.Close()
+}
+
+// copyAndCloseWrite copies from src to dst, then half-closes dst so the peer
+// sees EOF while data can still flow in the other direction.
+func copyAndCloseWrite(dst, src net.Conn) {
+	_, _ = io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
+
+// dialTunnel connects to the unencrypted endpoint of a Tunnel if it has one,
+// or to the TLS endpoint otherwise.
+func dialTunnel(ctx context.Context, tunnel *Tunnel) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if host, port, err := tunnel.TCPSocket(); err == nil {
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	host, port := tunnel.TLSSocket()
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+	return tlsDialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// tunnel returns the Tunnel for a container port of the Sandbox.
+func (sb *Sandbox) tunnel(containerPort int) (*Tunnel, error) {
+	tunnels, err := sb.Tunnels(tunnelLookupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	tunnel, ok := tunnels[containerPort]
+	if !ok {
+		return nil, InvalidError{Exception: fmt.Sprintf("port %d is not tunneled for Sandbox %s", containerPort, sb.SandboxId)}
+	}
+	return tunnel, nil
+}
@@ -0,0 +1,350 @@
+package modal
+
+// Pool of warm Sandboxes, to hide Sandbox cold start latency.
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultSandboxPoolCheckInterval = 30 * time.Second
+
+// SandboxPoolOptions are options for creating a SandboxPool.
+type SandboxPoolOptions struct {
+	Size          int             // Number of idle Sandboxes to keep warm.
+	MaxSize       int             // Maximum number of Sandboxes, idle and acquired (default: no limit).
+	MaxAge        time.Duration   // Sandboxes older than this are replaced (default: no limit).
+	CheckInterval time.Duration   // Time between health checks of idle Sandboxes (default 30s).
+	Sandbox       *SandboxOptions // Options for creating each Sandbox in the pool.
+}
+
+// SandboxPool keeps a number of Sandboxes running with the same Image and
+// options, so they can be handed out without waiting for a cold start.
+//
+// Idle Sandboxes that have exited or are older than MaxAge are replaced in the
+// background. Close the pool to terminate all of its Sandboxes.
+type SandboxPool struct {
+	app     *App
+	image   *Image
+	options SandboxPoolOptions
+
+	mu        sync.Mutex // protects the fields below
+	idle      []pooledSandbox
+	acquired  map[*Sandbox]time.Time // creation time of each acquired Sandbox
+	pending   int                    // Sandboxes being created to refill the pool
+	launching int                    // Sandboxes being created directly by Acquire
+	closed    bool
+	changed   chan struct{} // closed and replaced whenever a Sandbox is freed
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup // background Sandbox creations
+}
+
+type pooledSandbox struct {
+	sb        *Sandbox
+	createdAt time.Time
+}
+
+// NewSandboxPool creates a pool of Sandboxes in the App with the specified
+// image, and starts filling it in the background.
+func NewSandboxPool(app *App, image *Image, options *SandboxPoolOptions) (*SandboxPool, error) {
+	if options == nil {
+		options = &SandboxPoolOptions{}
+	}
+	if options.Size < 0 {
+		return nil, InvalidError{"sandbox pool size must not be negative"}
+	}
+	if options.MaxSize > 0 && options.MaxSize < options.Size {
+		return nil, InvalidError{"sandbox pool max size must be at least its size"}
+	}
+
+	p := &SandboxPool{
+		app:      app,
+		image:    image,
+		options:  *options,
+		acquired: map[*Sandbox]time.Time{},
+		changed:  make(chan struct{}),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if p.options.CheckInterval <= 0 {
+		p.options.CheckInterval = defaultSandboxPoolCheckInterval
+	}
+
+	go p.maintain()
+	return p, nil
+}
+
+// Acquire takes a running Sandbox from the pool. If no Sandbox is idle, a new
+// one is created with ctx, unless the pool is at MaxSize, in which case
+// Acquire blocks until a Sandbox is released or ctx is done.
+//
+// Acquired Sandboxes must be handed back with Release.
+func (p *SandboxPool) Acquire(ctx context.Context) (*Sandbox, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, InvalidError{"sandbox pool is closed"}
+		}
+
+		if len(p.idle) > 0 {
+			ps := p.idle[0]
+			p.idle = p.idle[1:]
+			p.acquired[ps.sb] = ps.createdAt
+			p.mu.Unlock()
+			p.requestFill()
+
+			if p.healthy(ps.sb, ps.createdAt) {
+				return ps.sb, nil
+			}
+			p.discard(ps.sb)
+			continue
+		}
+
+		if p.options.MaxSize == 0 || p.totalLocked() < p.options.MaxSize {
+			p.launching++
+			p.mu.Unlock()
+
+			sb, err := p.create(ctx)
+			createdAt := time.Now()
+
+			p.mu.Lock()
+			p.launching--
+			if err != nil {
+				p.notifyLocked()
+				p.mu.Unlock()
+				return nil, err
+			}
+			if p.closed {
+				p.mu.Unlock()
+				sb.Terminate()
+				return nil, InvalidError{"sandbox pool is closed"}
+			}
+			p.acquired[sb] = createdAt
+			p.mu.Unlock()
+			return sb, nil
+		}
+
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release hands an acquired Sandbox back to the pool. If reuse is true and the
+// Sandbox is still running and not too old, it is kept warm for the next
+// Acquire. Otherwise it is terminated and replaced.
+func (p *SandboxPool) Release(sb *Sandbox, reuse bool) error {
+	p.mu.Lock()
+	createdAt, ok := p.acquired[sb]
+	p.mu.Unlock()
+	if !ok {
+		return InvalidError{"sandbox " + sb.SandboxId + " was not acquired from this pool"}
+	}
+
+	reuse = reuse && p.healthy(sb, createdAt)
+
+	p.mu.Lock()
+	delete(p.acquired, sb)
+	p.notifyLocked()
+	if reuse && !p.closed && len(p.idle)+p.pending < p.options.Size {
+		p.idle = append(p.idle, pooledSandbox{sb: sb, createdAt: createdAt})
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+
+	p.requestFill()
+	return sb.Terminate()
+}
+
+// Close terminates all Sandboxes of the pool, including acquired ones, and
+// stops refilling it.
+func (p *SandboxPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	sandboxes := make([]*Sandbox, 0, len(p.idle)+len(p.acquired))
+	for _, ps := range p.idle {
+		sandboxes = append(sandboxes, ps.sb)
+	}
+	for sb := range p.acquired {
+		sandboxes = append(sandboxes, sb)
+	}
+	p.idle = nil
+	p.acquired = map[*Sandbox]time.Time{}
+	p.notifyLocked()
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+	p.wg.Wait()
+
+	var errs []error
+	for _, sb := range sandboxes {
+		if err := sb.Terminate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// maintain refills the pool and replaces unhealthy idle Sandboxes until the
+// pool is closed.
+func (p *SandboxPool) maintain() {
+	defer close(p.done)
+	t := time.NewTicker(p.options.CheckInterval)
+	defer t.Stop()
+
+	p.fill()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-p.kick:
+			p.fill()
+		case <-t.C:
+			p.checkIdle()
+			p.fill()
+		}
+	}
+}
+
+// fill starts creating Sandboxes until the pool has Size idle Sandboxes.
+func (p *SandboxPool) fill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+
+	n := p.options.Size - len(p.idle) - p.pending
+	if p.options.MaxSize > 0 {
+		n = min(n, p.options.MaxSize-p.totalLocked())
+	}
+	for range max(n, 0) {
+		p.pending++
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			sb, err := p.app.CreateSandbox(p.image, p.options.Sandbox)
+			createdAt := time.Now()
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.pending--
+			if err != nil {
+				p.notifyLocked() // let blocked Acquire calls use the freed capacity
+				return           // retried on the next check
+			}
+			if p.closed {
+				go sb.Terminate()
+				return
+			}
+			p.idle = append(p.idle, pooledSandbox{sb: sb, createdAt: createdAt})
+			p.notifyLocked()
+		}()
+	}
+}
+
+// create creates a Sandbox for the pool, cancelling creation if ctx is done.
+// Sandboxes outlive the Acquire call that created them, so
+// TerminateOnContextDone binds them to the App instead of to ctx.
+func (p *SandboxPool) create(ctx context.Context) (*Sandbox, error) {
+	options := SandboxOptions{}
+	if p.options.Sandbox != nil {
+		options = *p.options.Sandbox
+	}
+	terminateOnAppDone := options.TerminateOnContextDone
+	options.TerminateOnContextDone = false
+
+	sb, err := p.app.CreateSandboxContext(ctx, p.image, &options)
+	if err != nil {
+		return nil, err
+	}
+	if terminateOnAppDone {
+		sb.terminateOnContextDone(p.app.ctx)
+	}
+	return sb, nil
+}
+
+// checkIdle removes idle Sandboxes that have exited or are too old.
+func (p *SandboxPool) checkIdle() {
+	p.mu.Lock()
+	candidates := append([]pooledSandbox(nil), p.idle...)
+	p.mu.Unlock()
+
+	unhealthy := map[*Sandbox]bool{}
+	for _, ps := range candidates {
+		if !p.healthy(ps.sb, ps.createdAt) {
+			unhealthy[ps.sb] = true
+		}
+	}
+	if len(unhealthy) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	var removed []*Sandbox
+	idle := p.idle[:0]
+	for _, ps := range p.idle {
+		if unhealthy[ps.sb] {
+			removed = append(removed, ps.sb)
+		} else {
+			idle = append(idle, ps)
+		}
+	}
+	p.idle = idle
+	p.mu.Unlock()
+
+	for _, sb := range removed {
+		sb.Terminate()
+	}
+}
+
+// healthy reports whether a Sandbox is still running and younger than MaxAge.
+func (p *SandboxPool) healthy(sb *Sandbox, createdAt time.Time) bool {
+	if p.options.MaxAge > 0 && time.Since(createdAt) >= p.options.MaxAge {
+		return false
+	}
+	exitCode, err := sb.Poll()
+	return err == nil && exitCode == nil
+}
+
+// discard terminates an acquired Sandbox and removes it from the pool.
+func (p *SandboxPool) discard(sb *Sandbox) {
+	p.mu.Lock()
+	delete(p.acquired, sb)
+	p.notifyLocked()
+	p.mu.Unlock()
+	go sb.Terminate()
+}
+
+func (p *SandboxPool) requestFill() {
+	select {
+	case p.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (p *SandboxPool) totalLocked() int {
+	return len(p.idle) + len(p.acquired) + p.pending + p.launching
+}
+
+func (p *SandboxPool) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
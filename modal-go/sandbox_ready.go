@@ -0,0 +1,181 @@
+package modal
+
+// Helpers for waiting until a process inside a Sandbox is ready to use.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReadyInterval = 1 * time.Second
+	defaultReadyTimeout  = 5 * time.Minute
+
+	// readinessProbeTimeout bounds a single probe attempt.
+	readinessProbeTimeout = 10 * time.Second
+
+	// tcpProbeReadWindow is how long a TCP probe waits to see if the tunnel
+	// closes the connection, which happens when nothing listens on the port.
+	tcpProbeReadWindow = 500 * time.Millisecond
+)
+
+// ReadinessProbe checks whether a Sandbox is ready. It returns nil when
+// ready, or an error describing why it is not ready yet. An InvalidError
+// stops waiting immediately.
+type ReadinessProbe func(sb *Sandbox) error
+
+// WaitReadyOptions are options for Sandbox.WaitReady.
+type WaitReadyOptions struct {
+	Interval time.Duration // Time between probe attempts (default 1s).
+	Timeout  time.Duration // Maximum time to wait for readiness (default 5m).
+}
+
+// WaitReady blocks until the probe succeeds.
+//
+// Returns SandboxTimeoutError if the Sandbox is not ready after the timeout,
+// or ExecutionError if the Sandbox exits before becoming ready.
+func (sb *Sandbox) WaitReady(probe ReadinessProbe, options *WaitReadyOptions) error {
+	if err := sb.checkRunning(); err != nil {
+		return err
+	}
+	if options == nil {
+		options = &WaitReadyOptions{}
+	}
+	interval := options.Interval
+	if interval <= 0 {
+		interval = defaultReadyInterval
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		probeErr := probe(sb)
+		if probeErr == nil {
+			return nil
+		}
+		if errors.As(probeErr, &InvalidError{}) {
+			return probeErr
+		}
+
+		result, err := sb.poll()
+		if err != nil {
+			return err
+		}
+		if result != nil {
+			return ExecutionError{Exception: fmt.Sprintf("Sandbox %s finished with status %s and exit code %d before becoming ready", sb.SandboxId, result.Status, result.ExitCode)}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return SandboxTimeoutError{Exception: fmt.Sprintf("Sandbox %s was not ready within %s: %v", sb.SandboxId, timeout, probeErr)}
+		}
+		if err := sleepCtx(sb.ctx, min(interval, remaining)); err != nil {
+			return err
+		}
+	}
+}
+
+// ProbeCommand is ready when the command exits with code 0 inside the Sandbox.
+func ProbeCommand(command []string) ReadinessProbe {
+	return func(sb *Sandbox) error {
+		p, err := sb.Exec(command, ExecOptions{
+			Stdout:  Ignore,
+			Stderr:  Ignore,
+			Timeout: readinessProbeTimeout,
+		})
+		if err != nil {
+			return err
+		}
+		exitCode, err := p.Wait()
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("command %q exited with code %d", strings.Join(command, " "), exitCode)
+		}
+		return nil
+	}
+}
+
+// ProbeFile is ready when the file exists inside the Sandbox.
+func ProbeFile(path string) ReadinessProbe {
+	return func(sb *Sandbox) error {
+		f, err := sb.Open(path, "r")
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// ProbeTCP is ready when the container port accepts connections through its
+// Tunnel. The port must be in EncryptedPorts or UnencryptedPorts of the Sandbox.
+func ProbeTCP(containerPort int) ReadinessProbe {
+	return func(sb *Sandbox) error {
+		tunnel, err := sb.tunnel(containerPort)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(sb.ctx, readinessProbeTimeout)
+		defer cancel()
+		conn, err := dialTunnel(ctx, tunnel)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		// The tunnel accepts connections even when nothing is listening in the
+		// container, and then closes them right away.
+		if err := conn.SetReadDeadline(time.Now().Add(tcpProbeReadWindow)); err != nil {
+			return err
+		}
+		_, err = conn.Read(make([]byte, 1))
+		if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		if err == io.EOF {
+			return fmt.Errorf("connection to port %d was closed", containerPort)
+		}
+		return err
+	}
+}
+
+// ProbeHTTP is ready when a GET request to the path on the container port
+// returns a 2xx status. The port must be in EncryptedPorts or H2Ports of the Sandbox.
+func ProbeHTTP(containerPort int, path string) ReadinessProbe {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return func(sb *Sandbox) error {
+		tunnel, err := sb.tunnel(containerPort)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(sb.ctx, "GET", tunnel.URL()+path, nil)
+		if err != nil {
+			return err
+		}
+		httpClient := &http.Client{Timeout: readinessProbeTimeout}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("GET %s returned %s", path, resp.Status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+package modal
+
+// Memory snapshots of Sandboxes, which can be restored into new Sandboxes.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SandboxSnapshot references a snapshot of the memory and filesystem of a
+// Sandbox. The Sandbox must have been created with SandboxOptions.EnableSnapshot.
+type SandboxSnapshot struct {
+	SnapshotId string
+	ctx        context.Context
+}
+
+// Snapshot starts taking a snapshot of the memory and filesystem of the Sandbox.
+// Call Wait on the returned SandboxSnapshot before restoring it.
+func (sb *Sandbox) Snapshot() (*SandboxSnapshot, error) {
+	if err := sb.checkRunning(); err != nil {
+		return nil, err
+	}
+	resp, err := client.SandboxSnapshot(sb.ctx, pb.SandboxSnapshotRequest_builder{
+		SandboxId: sb.SandboxId,
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+	return &SandboxSnapshot{SnapshotId: resp.GetSnapshotId(), ctx: sb.ctx}, nil
+}
+
+// SandboxSnapshotFromId looks up a SandboxSnapshot by ID.
+func SandboxSnapshotFromId(ctx context.Context, snapshotId string) (*SandboxSnapshot, error) {
+	ctx, err := clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.SandboxSnapshotGet(ctx, pb.SandboxSnapshotGetRequest_builder{
+		SnapshotId: snapshotId,
+	}.Build())
+	if status, ok := status.FromError(err); ok && status.Code() == codes.NotFound {
+		return nil, NotFoundError{fmt.Sprintf("Sandbox snapshot with id: '%s' not found", snapshotId)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SandboxSnapshot{SnapshotId: resp.GetSnapshotId(), ctx: ctx}, nil
+}
+
+// Wait blocks until the snapshot has been taken.
+// Returns SandboxTimeoutError if the snapshot is not ready after the timeout,
+// or ExecutionError if the snapshot failed.
+func (s *SandboxSnapshot) Wait(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pollTimeout := min(55*time.Second, max(0, time.Until(deadline)))
+		resp, err := client.SandboxSnapshotWait(s.ctx, pb.SandboxSnapshotWaitRequest_builder{
+			SnapshotId: s.SnapshotId,
+			Timeout:    float32(pollTimeout.Seconds()),
+		}.Build())
+		if err != nil {
+			return err
+		}
+
+		result := resp.GetResult()
+		switch result.GetStatus() {
+		case pb.GenericResult_GENERIC_STATUS_SUCCESS:
+			return nil
+		case pb.GenericResult_GENERIC_STATUS_UNSPECIFIED, pb.GenericResult_GENERIC_STATUS_TIMEOUT:
+			// Not finished yet.
+		default:
+			return ExecutionError{Exception: fmt.Sprintf("Sandbox snapshot failed: %s", result.GetException())}
+		}
+
+		if !time.Now().Before(deadline) {
+			return SandboxTimeoutError{Exception: fmt.Sprintf("Sandbox snapshot %s was not ready within %s", s.SnapshotId, timeout)}
+		}
+	}
+}
+
+// SandboxRestore creates a new running Sandbox from a snapshot, with the same
+// memory and filesystem state as the original Sandbox when it was snapshotted.
+func SandboxRestore(ctx context.Context, snapshot *SandboxSnapshot) (*Sandbox, error) {
+	ctx, err := clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.SandboxRestore(ctx, pb.SandboxRestoreRequest_builder{
+		SnapshotId: snapshot.SnapshotId,
+	}.Build())
+	if status, ok := status.FromError(err); ok && status.Code() == codes.NotFound {
+		return nil, NotFoundError{fmt.Sprintf("Sandbox snapshot with id: '%s' not found", snapshot.SnapshotId)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	taskResp, err := client.SandboxGetTaskId(ctx, pb.SandboxGetTaskIdRequest_builder{
+		SandboxId:      resp.GetSandboxId(),
+		WaitUntilReady: true,
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+	if result := taskResp.GetTaskResult(); result != nil &&
+		result.GetStatus() != pb.GenericResult_GENERIC_STATUS_UNSPECIFIED &&
+		result.GetStatus() != pb.GenericResult_GENERIC_STATUS_SUCCESS {
+		return nil, ExecutionError{Exception: fmt.Sprintf("Sandbox restore failed: %s", result.GetException())}
+	}
+
+	sb := newSandbox(ctx, resp.GetSandboxId())
+	sb.taskId = taskResp.GetTaskId()
+	return sb, nil
+}
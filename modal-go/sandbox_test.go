@@ -0,0 +1,154 @@
+package modal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"github.com/onsi/gomega"
+)
+
+func TestSandboxResultFromProto(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	g.Expect(sandboxResultFromProto(nil)).Should(gomega.BeNil())
+	g.Expect(sandboxResultFromProto(pb.GenericResult_builder{}.Build())).Should(gomega.BeNil())
+
+	// A real exit code of 137 is distinguishable from a termination.
+	exited := sandboxResultFromProto(pb.GenericResult_builder{
+		Status:   pb.GenericResult_GENERIC_STATUS_FAILURE,
+		Exitcode: 137,
+	}.Build())
+	g.Expect(exited.Status).Should(gomega.Equal(SandboxStatusFailure))
+	g.Expect(exited.ExitCode).Should(gomega.Equal(137))
+
+	terminated := sandboxResultFromProto(pb.GenericResult_builder{
+		Status:    pb.GenericResult_GENERIC_STATUS_TERMINATED,
+		Exception: "terminated by user",
+	}.Build())
+	g.Expect(terminated.Status).Should(gomega.Equal(SandboxStatusTerminated))
+	g.Expect(terminated.Exception).Should(gomega.Equal("terminated by user"))
+	g.Expect(terminated.returnCode()).Should(gomega.Equal(137))
+
+	timeout := sandboxResultFromProto(pb.GenericResult_builder{
+		Status: pb.GenericResult_GENERIC_STATUS_TIMEOUT,
+	}.Build())
+	g.Expect(timeout.Status).Should(gomega.Equal(SandboxStatusTimeout))
+	g.Expect(timeout.returnCode()).Should(gomega.Equal(124))
+
+	internal := sandboxResultFromProto(pb.GenericResult_builder{
+		Status: pb.GenericResult_GENERIC_STATUS_INTERNAL_FAILURE,
+	}.Build())
+	g.Expect(internal.Status).Should(gomega.Equal(SandboxStatusInternalFailure))
+}
+
+func TestSandboxFinished(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	sb := newSandbox(context.Background(), "sb-123")
+	g.Expect(sb.checkRunning()).Should(gomega.Succeed())
+	g.Expect(sb.done).ShouldNot(gomega.BeClosed())
+
+	sb.finish()
+	g.Expect(sb.done).Should(gomega.BeClosed())
+	sb.finish() // finishing twice is a no-op
+
+	// Methods that need a running Sandbox fail without calling Modal.
+	var terminatedErr SandboxTerminatedError
+	_, err := sb.Exec([]string{"true"}, ExecOptions{})
+	g.Expect(errors.As(err, &terminatedErr)).Should(gomega.BeTrue())
+	_, err = sb.Open("/tmp/file", "r")
+	g.Expect(errors.As(err, &terminatedErr)).Should(gomega.BeTrue())
+	_, err = sb.Tunnels(0)
+	g.Expect(errors.As(err, &terminatedErr)).Should(gomega.BeTrue())
+
+	// Terminating again is a no-op.
+	g.Expect(sb.Terminate()).Should(gomega.Succeed())
+}
+
+func TestSandboxFromInfo(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	running := sandboxFromInfo(context.Background(), pb.SandboxInfo_builder{
+		Id:       "sb-123",
+		TaskInfo: pb.TaskInfo_builder{StartedAt: 1700000000}.Build(),
+	}.Build())
+	g.Expect(running.State).Should(gomega.Equal(SandboxStateRunning))
+	g.Expect(running.checkRunning()).Should(gomega.Succeed())
+
+	// Finished Sandboxes are known to be finished without calling Modal.
+	finished := sandboxFromInfo(context.Background(), pb.SandboxInfo_builder{
+		Id: "sb-456",
+		TaskInfo: pb.TaskInfo_builder{
+			StartedAt:  1700000000,
+			FinishedAt: 1700000060,
+			Result:     pb.GenericResult_builder{Status: pb.GenericResult_GENERIC_STATUS_SUCCESS}.Build(),
+		}.Build(),
+	}.Build())
+	g.Expect(finished.State).Should(gomega.Equal(SandboxStateFinished))
+	g.Expect(finished.FinishedAt).Should(gomega.Equal(time.Unix(1700000060, 0)))
+	g.Expect(finished.Done()).Should(gomega.BeClosed())
+	g.Expect(finished.checkRunning()).Should(gomega.BeAssignableToTypeOf(SandboxTerminatedError{}))
+}
+
+func TestSandboxDoneContextCancelled(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sb := newSandbox(ctx, "sb-123")
+	g.Eventually(sb.Done(), 5*time.Second).Should(gomega.BeClosed())
+	g.Expect(sb.Err()).Should(gomega.MatchError(context.Canceled))
+
+	// Sandboxes that finished normally have no error.
+	sb = newSandbox(context.Background(), "sb-456")
+	sb.finish()
+	g.Expect(sb.Done()).Should(gomega.BeClosed())
+	g.Expect(sb.Err()).ShouldNot(gomega.HaveOccurred())
+}
+
+func TestSandboxTaskIdConcurrentFinish(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	sb := newSandbox(context.Background(), "sb-123")
+	sb.taskId = "ta-123"
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			taskId, err := sb.ensureTaskId()
+			if err == nil {
+				g.Expect(taskId).Should(gomega.Equal("ta-123"))
+			}
+		}()
+	}
+	sb.finish()
+	wg.Wait()
+
+	_, err := sb.ensureTaskId()
+	g.Expect(err).Should(gomega.BeAssignableToTypeOf(SandboxTerminatedError{}))
+}
+
+func TestSandboxOutputStreamMode(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	sb := newSandbox(context.Background(), "sb-123")
+	_, err := io.ReadAll(sb.OutputStream(FileDescriptorStdout, &OutputStreamOptions{Mode: StreamModeBinary}))
+	g.Expect(err).Should(gomega.BeAssignableToTypeOf(InvalidError{}))
+
+	cp := newContainerProcess(context.Background(), "ex-123", ExecOptions{Mode: "bytes"})
+	_, err = io.ReadAll(cp.Stdout)
+	g.Expect(err).Should(gomega.BeAssignableToTypeOf(InvalidError{}))
+}
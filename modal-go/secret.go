@@ -2,15 +2,19 @@ package modal
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"time"
 
 	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Secret represents a Modal secret.
 type Secret struct {
 	SecretId string
 
-	//lint:ignore U1000 may be used in future
 	ctx context.Context
 }
 
@@ -42,5 +46,150 @@ func SecretFromName(ctx context.Context, name string, options *SecretFromNameOpt
 		return nil, err
 	}
 
-	return &Secret{SecretId: resp.GetSecretId()}, nil
+	return &Secret{SecretId: resp.GetSecretId(), ctx: ctx}, nil
+}
+
+// SecretFromMapOptions are options for creating ephemeral Secrets.
+type SecretFromMapOptions struct {
+	Environment string // Environment to create the Secret in.
+}
+
+// SecretFromMap creates a nameless Secret with the given environment
+// variables, which is deleted by Modal when it is no longer used.
+func SecretFromMap(ctx context.Context, values map[string]string, options *SecretFromMapOptions) (*Secret, error) {
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if options == nil {
+		options = &SecretFromMapOptions{}
+	}
+
+	resp, err := client.SecretGetOrCreate(ctx, pb.SecretGetOrCreateRequest_builder{
+		EnvironmentName:    environmentName(options.Environment),
+		ObjectCreationType: pb.ObjectCreationType_OBJECT_CREATION_TYPE_EPHEMERAL,
+		EnvDict:            values,
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Secret{SecretId: resp.GetSecretId(), ctx: ctx}, nil
+}
+
+// SecretFromDotenv creates a nameless Secret with the variables of a .env
+// file, like SecretFromMap.
+func SecretFromDotenv(ctx context.Context, path string, options *SecretFromMapOptions) (*Secret, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseDotenv(string(data))
+	if err != nil {
+		return nil, InvalidError{fmt.Sprintf("invalid .env file %s: %v", path, err)}
+	}
+	return SecretFromMap(ctx, values, options)
+}
+
+// SecretCreateOptions are options for creating named Secrets.
+type SecretCreateOptions struct {
+	Environment string // Environment to create the Secret in.
+	Overwrite   bool   // Replace the values of an existing Secret with the same name.
+}
+
+// SecretCreate creates a named Secret with the given environment variables.
+// If a Secret with the name exists, it returns an AlreadyExistsError unless
+// options.Overwrite is set.
+func SecretCreate(ctx context.Context, name string, values map[string]string, options *SecretCreateOptions) (*Secret, error) {
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if options == nil {
+		options = &SecretCreateOptions{}
+	}
+
+	creationType := pb.ObjectCreationType_OBJECT_CREATION_TYPE_CREATE_FAIL_IF_EXISTS
+	if options.Overwrite {
+		creationType = pb.ObjectCreationType_OBJECT_CREATION_TYPE_CREATE_OVERWRITE_IF_EXISTS
+	}
+
+	resp, err := client.SecretGetOrCreate(ctx, pb.SecretGetOrCreateRequest_builder{
+		DeploymentName:     name,
+		EnvironmentName:    environmentName(options.Environment),
+		ObjectCreationType: creationType,
+		EnvDict:            values,
+	}.Build())
+	if status, ok := status.FromError(err); ok && status.Code() == codes.AlreadyExists {
+		return nil, AlreadyExistsError{fmt.Sprintf("Secret '%s' already exists", name)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Secret{SecretId: resp.GetSecretId(), ctx: ctx}, nil
+}
+
+// SecretListOptions are options for listing Secrets.
+type SecretListOptions struct {
+	Environment string // Environment to list Secrets in.
+}
+
+// SecretInfo describes a named Secret, as returned by SecretList.
+type SecretInfo struct {
+	Name        string
+	SecretId    string
+	Environment string
+	CreatedAt   time.Time
+	LastUsedAt  time.Time // Zero if the Secret was never used.
+}
+
+// SecretList lists the named Secrets of an environment. Their values are
+// not returned.
+func SecretList(ctx context.Context, options *SecretListOptions) ([]SecretInfo, error) {
+	var err error
+	ctx, err = clientContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if options == nil {
+		options = &SecretListOptions{}
+	}
+
+	resp, err := client.SecretList(ctx, pb.SecretListRequest_builder{
+		EnvironmentName: environmentName(options.Environment),
+	}.Build())
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]SecretInfo, len(resp.GetItems()))
+	for i, item := range resp.GetItems() {
+		secrets[i] = SecretInfo{
+			Name:        item.GetLabel(),
+			SecretId:    item.GetSecretId(),
+			Environment: item.GetEnvironmentName(),
+			CreatedAt:   timeFromSeconds(item.GetCreatedAt()),
+			LastUsedAt:  timeFromSeconds(item.GetLastUsedAt()),
+		}
+	}
+	return secrets, nil
+}
+
+// SecretDelete deletes a named Secret.
+func SecretDelete(ctx context.Context, name string, options *DeleteOptions) error {
+	if options == nil {
+		options = &DeleteOptions{}
+	}
+	secret, err := SecretFromName(ctx, name, &SecretFromNameOptions{Environment: options.Environment})
+	if err != nil {
+		return err
+	}
+	_, err = client.SecretDelete(secret.ctx, pb.SecretDeleteRequest_builder{SecretId: secret.SecretId}.Build())
+	return err
 }
@@ -0,0 +1,497 @@
+package modal
+
+// Output streams of Sandboxes and ContainerProcesses.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djherbis/buffer"
+	"github.com/djherbis/nio/v3"
+	pb "github.com/modal-labs/libmodal/modal-go/proto/modal_proto"
+)
+
+const (
+	outputStreamBufferSize     = 64 * 1024
+	outputStreamRetries        = 10
+	outputStreamInitialBackoff = 100 * time.Millisecond
+	outputStreamMaxBackoff     = 5 * time.Second
+)
+
+// FileDescriptor selects an output stream of a Sandbox or ContainerProcess.
+type FileDescriptor int
+
+const (
+	// FileDescriptorStdout is the standard output stream.
+	FileDescriptorStdout = FileDescriptor(pb.FileDescriptor_FILE_DESCRIPTOR_STDOUT)
+	// FileDescriptorStderr is the standard error stream.
+	FileDescriptorStderr = FileDescriptor(pb.FileDescriptor_FILE_DESCRIPTOR_STDERR)
+	// FileDescriptorInfo is the stream of informational messages from Modal.
+	FileDescriptorInfo = FileDescriptor(pb.FileDescriptor_FILE_DESCRIPTOR_INFO)
+)
+
+// StreamMode selects how output of a ContainerProcess is read. Output of
+// Sandboxes is always text, as Modal sends it as text.
+type StreamMode string
+
+const (
+	// StreamModeText reads output as UTF-8 text. Invalid UTF-8 sequences are
+	// replaced with U+FFFD, following the WHATWG Encoding Standard like the
+	// JavaScript SDK does.
+	StreamModeText StreamMode = "text"
+	// StreamModeBinary reads output as raw bytes.
+	StreamModeBinary StreamMode = "binary"
+)
+
+// OutputStreamOptions are options for opening an OutputStream.
+type OutputStreamOptions struct {
+	// LastEntryId resumes the stream after this entry, as returned by
+	// OutputStream.LastEntryId. By default, the stream starts from the beginning.
+	LastEntryId string
+	// Mode selects text or binary output of a ContainerProcess. Defaults to
+	// ExecOptions.Mode. Output of Sandboxes is always text, and other modes
+	// are rejected for them.
+	Mode StreamMode
+}
+
+// outputBatch is a batch of output received from Modal.
+type outputBatch struct {
+	entryId string
+	items   []outputItem
+	eof     bool // no more output will follow
+}
+
+// outputItem is a chunk of output from one stream.
+type outputItem struct {
+	data      []byte
+	fd        FileDescriptor
+	timestamp time.Time // zero if not reported by Modal
+}
+
+// outputSource opens a server stream of output batches after lastEntryId,
+// returning a function that receives the next batch.
+type outputSource func(ctx context.Context, lastEntryId string) (func() (*outputBatch, error), error)
+
+// OutputStream is an output stream of a Sandbox or ContainerProcess.
+//
+// Output is fetched when the stream is first read, and can be read by
+// multiple readers created with NewReader. Each reader receives all output
+// fetched after it was created, so all readers should be created before
+// reading starts. Reading the OutputStream itself creates its reader on the
+// first call to Read. A slow reader holds back all other readers.
+type OutputStream struct {
+	ctx    context.Context
+	source outputSource // nil for a stream without output
+
+	mu          sync.Mutex // protects the fields below
+	writers     []*nio.PipeWriter
+	started     bool
+	done        bool  // output has ended, or fetching failed
+	err         error // error that fetching failed with
+	lastEntryId string
+
+	primaryOnce sync.Once
+	primary     io.ReadCloser // created on first use, so it doesn't hold back other readers until then
+}
+
+func newOutputStream(ctx context.Context, source outputSource, lastEntryId string) *OutputStream {
+	return &OutputStream{ctx: ctx, source: source, lastEntryId: lastEntryId}
+}
+
+// newFailedOutputStream returns an OutputStream whose readers fail with err.
+func newFailedOutputStream(ctx context.Context, err error) *OutputStream {
+	return &OutputStream{ctx: ctx, done: true, err: err}
+}
+
+// Read reads from the primary reader of the stream.
+func (s *OutputStream) Read(p []byte) (int, error) {
+	return s.primaryReader().Read(p)
+}
+
+// Close closes the primary reader of the stream. Output is no longer fetched
+// once all readers are closed.
+func (s *OutputStream) Close() error {
+	return s.primaryReader().Close()
+}
+
+func (s *OutputStream) primaryReader() io.ReadCloser {
+	s.primaryOnce.Do(func() {
+		s.primary = s.NewReader()
+	})
+	return s.primary
+}
+
+// LastEntryId returns the ID of the last entry that was passed on to the
+// readers, which can be used to resume the stream later.
+func (s *OutputStream) LastEntryId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastEntryId
+}
+
+// NewReader returns an additional reader that receives the output of the stream.
+func (s *OutputStream) NewReader() io.ReadCloser {
+	pr, pw := nio.Pipe(buffer.New(outputStreamBufferSize))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.source == nil || s.done {
+		pw.CloseWithError(s.err)
+	} else {
+		s.writers = append(s.writers, pw)
+	}
+	return &outputStreamReader{stream: s, pr: pr}
+}
+
+type outputStreamReader struct {
+	stream *OutputStream
+	pr     *nio.PipeReader
+}
+
+func (r *outputStreamReader) Read(p []byte) (int, error) {
+	r.stream.start()
+	return r.pr.Read(p)
+}
+
+func (r *outputStreamReader) Close() error {
+	return r.pr.Close()
+}
+
+// start begins fetching output, if it has not started yet.
+func (s *OutputStream) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.done || s.source == nil {
+		return
+	}
+	s.started = true
+	go s.fetch()
+}
+
+// fetch passes output on to all readers until the output ends, all readers
+// are closed, or fetching fails.
+func (s *OutputStream) fetch() {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	readersLeft := true
+	err := readBatches(ctx, s.source, s.LastEntryId(), func(batch *outputBatch) bool {
+		readersLeft = s.write(batch)
+		return readersLeft
+	})
+	if readersLeft {
+		s.closeWriters(err)
+	}
+}
+
+// readBatches calls handle with each batch of output after lastEntryId, until
+// the output ends or handle returns false. Transient errors are retried with
+// backoff, and the retry budget resets after each batch that is received.
+func readBatches(ctx context.Context, source outputSource, lastEntryId string, handle func(*outputBatch) bool) error {
+	retries := outputStreamRetries
+	delay := outputStreamInitialBackoff
+	retry := func(err error) error {
+		if !isRetryableGrpc(err) || retries == 0 {
+			return fmt.Errorf("error getting output stream: %w", err)
+		}
+		retries--
+		if err := sleepCtx(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(2*delay, outputStreamMaxBackoff)
+		return nil
+	}
+
+	for {
+		recv, err := source(ctx, lastEntryId)
+		if err != nil {
+			if err := retry(err); err != nil {
+				return err
+			}
+			continue
+		}
+		for {
+			batch, err := recv()
+			if err == io.EOF {
+				break // the server closed the stream, reopen it
+			}
+			if err != nil {
+				if err := retry(err); err != nil {
+					return err
+				}
+				break
+			}
+
+			retries = outputStreamRetries
+			delay = outputStreamInitialBackoff
+			if batch.entryId != "" {
+				lastEntryId = batch.entryId
+			}
+			if !handle(batch) || batch.eof {
+				return nil
+			}
+		}
+	}
+}
+
+// write passes a batch on to all open readers, and reports whether any
+// readers are left.
+func (s *OutputStream) write(batch *outputBatch) bool {
+	s.mu.Lock()
+	writers := s.writers
+	s.mu.Unlock()
+
+	open := writers[:0:0]
+	for _, pw := range writers {
+		ok := true
+		for _, item := range batch.items {
+			if _, err := pw.Write(item.data); err != nil {
+				ok = false // reader was closed
+				break
+			}
+		}
+		if ok {
+			open = append(open, pw)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Keep readers that were added while writing.
+	s.writers = append(open, s.writers[len(writers):]...)
+	if batch.entryId != "" {
+		s.lastEntryId = batch.entryId
+	}
+	if len(s.writers) == 0 {
+		s.started = false // a new reader resumes fetching
+		return false
+	}
+	return true
+}
+
+func (s *OutputStream) closeWriters(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	s.err = err
+	for _, pw := range s.writers {
+		pw.CloseWithError(err)
+	}
+	s.writers = nil
+}
+
+// sandboxOutputSource streams the output of a Sandbox.
+func sandboxOutputSource(sandboxId string, fd FileDescriptor) outputSource {
+	return func(ctx context.Context, lastEntryId string) (func() (*outputBatch, error), error) {
+		if lastEntryId == "" {
+			lastEntryId = "0-0"
+		}
+		stream, err := client.SandboxGetLogs(ctx, pb.SandboxGetLogsRequest_builder{
+			SandboxId:      sandboxId,
+			FileDescriptor: pb.FileDescriptor(fd),
+			Timeout:        55,
+			LastEntryId:    lastEntryId,
+		}.Build())
+		if err != nil {
+			return nil, err
+		}
+		return func() (*outputBatch, error) {
+			batch, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			items := make([]outputItem, len(batch.GetItems()))
+			for i, item := range batch.GetItems() {
+				items[i] = outputItem{
+					data:      []byte(item.GetData()),
+					fd:        itemFileDescriptor(item.GetFileDescriptor(), fd),
+					timestamp: timeFromSeconds(item.GetTimestamp()),
+				}
+				if ns := item.GetTimestampNs(); ns != 0 {
+					items[i].timestamp = time.Unix(0, int64(ns))
+				}
+			}
+			return &outputBatch{entryId: batch.GetEntryId(), items: items, eof: batch.GetEof()}, nil
+		}, nil
+	}
+}
+
+// execOutputSource streams the output of a ContainerProcess. Entry IDs are
+// batch indexes.
+func execOutputSource(execId string, fd FileDescriptor) outputSource {
+	return func(ctx context.Context, lastEntryId string) (func() (*outputBatch, error), error) {
+		var lastIndex uint64
+		if lastEntryId != "" {
+			var err error
+			lastIndex, err = strconv.ParseUint(lastEntryId, 10, 64)
+			if err != nil {
+				return nil, InvalidError{fmt.Sprintf("invalid entry ID for exec output: %q", lastEntryId)}
+			}
+		}
+		stream, err := client.ContainerExecGetOutput(ctx, pb.ContainerExecGetOutputRequest_builder{
+			ExecId:         execId,
+			FileDescriptor: pb.FileDescriptor(fd),
+			Timeout:        55,
+			GetRawBytes:    true,
+			LastBatchIndex: lastIndex,
+		}.Build())
+		if err != nil {
+			return nil, err
+		}
+		return func() (*outputBatch, error) {
+			batch, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			items := make([]outputItem, len(batch.GetItems()))
+			for i, item := range batch.GetItems() {
+				items[i] = outputItem{
+					data: item.GetMessageBytes(),
+					fd:   itemFileDescriptor(item.GetFileDescriptor(), fd),
+				}
+			}
+			return &outputBatch{
+				entryId: strconv.FormatUint(batch.GetBatchIndex(), 10),
+				items:   items,
+				eof:     batch.HasExitCode(),
+			}, nil
+		}, nil
+	}
+}
+
+// withStreamMode decodes the output of a source as UTF-8 text in text mode,
+// or returns the source unchanged otherwise.
+func withStreamMode(source outputSource, mode StreamMode) outputSource {
+	if mode != StreamModeText {
+		return source
+	}
+
+	// Decoders are shared across reconnections, so that characters split
+	// across batches are decoded correctly.
+	decoders := map[FileDescriptor]*utf8Decoder{}
+	return func(ctx context.Context, lastEntryId string) (func() (*outputBatch, error), error) {
+		recv, err := source(ctx, lastEntryId)
+		if err != nil {
+			return nil, err
+		}
+		return func() (*outputBatch, error) {
+			batch, err := recv()
+			if err != nil {
+				return nil, err
+			}
+			decoded := *batch
+			decoded.items = make([]outputItem, 0, len(batch.items))
+			for _, item := range batch.items {
+				d, ok := decoders[item.fd]
+				if !ok {
+					d = &utf8Decoder{}
+					decoders[item.fd] = d
+				}
+				item.data = d.decode(item.data)
+				decoded.items = append(decoded.items, item)
+			}
+			if batch.eof {
+				for fd, d := range decoders {
+					if rest := d.flush(); len(rest) > 0 {
+						decoded.items = append(decoded.items, outputItem{data: rest, fd: fd})
+					}
+				}
+			}
+			return &decoded, nil
+		}, nil
+	}
+}
+
+// utf8Decoder incrementally decodes UTF-8, replacing each maximal invalid
+// subsequence with U+FFFD as specified by the WHATWG Encoding Standard.
+type utf8Decoder struct {
+	needed  int  // continuation bytes needed for the current character
+	seen    int  // continuation bytes seen for the current character
+	lower   byte // bounds of the next continuation byte
+	upper   byte
+	pending []byte // bytes of the current, incomplete character
+}
+
+// decode returns the decoded text of p. Bytes of a character that is not
+// complete yet are kept until the next call.
+func (d *utf8Decoder) decode(p []byte) []byte {
+	out := make([]byte, 0, len(p)+len(d.pending))
+	for i := 0; i < len(p); i++ {
+		b := p[i]
+		if d.needed == 0 {
+			d.lower, d.upper = 0x80, 0xBF
+			switch {
+			case b <= 0x7F:
+				out = append(out, b)
+			case b >= 0xC2 && b <= 0xDF:
+				d.start(b, 1)
+			case b >= 0xE0 && b <= 0xEF:
+				if b == 0xE0 {
+					d.lower = 0xA0
+				} else if b == 0xED {
+					d.upper = 0x9F
+				}
+				d.start(b, 2)
+			case b >= 0xF0 && b <= 0xF4:
+				if b == 0xF0 {
+					d.lower = 0x90
+				} else if b == 0xF4 {
+					d.upper = 0x8F
+				}
+				d.start(b, 3)
+			default:
+				out = utf8.AppendRune(out, utf8.RuneError)
+			}
+			continue
+		}
+
+		if b < d.lower || b > d.upper {
+			// Invalid continuation byte, which may start the next character.
+			d.reset()
+			out = utf8.AppendRune(out, utf8.RuneError)
+			i--
+			continue
+		}
+		d.lower, d.upper = 0x80, 0xBF
+		d.pending = append(d.pending, b)
+		d.seen++
+		if d.seen == d.needed {
+			out = append(out, d.pending...)
+			d.reset()
+		}
+	}
+	return out
+}
+
+// flush ends the input, returning U+FFFD for an incomplete character.
+func (d *utf8Decoder) flush() []byte {
+	if d.needed == 0 {
+		return nil
+	}
+	d.reset()
+	return utf8.AppendRune(nil, utf8.RuneError)
+}
+
+func (d *utf8Decoder) start(b byte, needed int) {
+	d.needed = needed
+	d.pending = append(d.pending[:0], b)
+}
+
+func (d *utf8Decoder) reset() {
+	d.needed, d.seen = 0, 0
+	d.lower, d.upper = 0x80, 0xBF
+	d.pending = d.pending[:0]
+}
+
+// itemFileDescriptor returns the stream of an output item, defaulting to the
+// stream that was requested.
+func itemFileDescriptor(itemFd pb.FileDescriptor, requested FileDescriptor) FileDescriptor {
+	if itemFd == pb.FileDescriptor_FILE_DESCRIPTOR_UNSPECIFIED {
+		return requested
+	}
+	return FileDescriptor(itemFd)
+}
@@ -0,0 +1,211 @@
+package modal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeOutputSource serves batches from a list, failing with the given errors
+// before each batch.
+type fakeOutputSource struct {
+	mu          sync.Mutex
+	batches     []*outputBatch
+	failures    map[int][]error // errors to return before serving batch i
+	lastEntries []string        // lastEntryId of each open call
+}
+
+func (f *fakeOutputSource) open(ctx context.Context, lastEntryId string) (func() (*outputBatch, error), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastEntries = append(f.lastEntries, lastEntryId)
+
+	next := 0
+	for i, b := range f.batches {
+		if b.entryId == lastEntryId {
+			next = i + 1
+		}
+	}
+	return func() (*outputBatch, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if errs := f.failures[next]; len(errs) > 0 {
+			f.failures[next] = errs[1:]
+			return nil, errs[0]
+		}
+		if next >= len(f.batches) {
+			return nil, io.EOF
+		}
+		b := f.batches[next]
+		next++
+		return b, nil
+	}, nil
+}
+
+func TestOutputStreamFanOut(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	source := &fakeOutputSource{batches: []*outputBatch{
+		{entryId: "1", items: []outputItem{{data: []byte("hello ")}}},
+		{entryId: "2", items: []outputItem{{data: []byte("world")}}, eof: true},
+	}}
+	stream := newOutputStream(context.Background(), source.open, "")
+	tee := stream.NewReader()
+
+	output, err := io.ReadAll(stream)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	teeOutput, err := io.ReadAll(tee)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	g.Expect(string(output)).Should(gomega.Equal("hello world"))
+	g.Expect(string(teeOutput)).Should(gomega.Equal("hello world"))
+	g.Expect(stream.LastEntryId()).Should(gomega.Equal("2"))
+
+	// Readers created after the output ended are at EOF.
+	late, err := io.ReadAll(stream.NewReader())
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(late).Should(gomega.BeEmpty())
+}
+
+func TestOutputStreamUnreadPrimary(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	// More output than fits in the buffer of a reader, which would block all
+	// readers if the unread primary reader counted as one.
+	chunk := bytes.Repeat([]byte("x"), outputStreamBufferSize/2)
+	var batches []*outputBatch
+	for i := range 5 {
+		batches = append(batches, &outputBatch{entryId: strconv.Itoa(i + 1), items: []outputItem{{data: chunk}}})
+	}
+	batches[len(batches)-1].eof = true
+	source := &fakeOutputSource{batches: batches}
+	stream := newOutputStream(context.Background(), source.open, "")
+
+	readers := []io.ReadCloser{stream.NewReader(), stream.NewReader()}
+	outputs := make([][]byte, len(readers))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, r := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outputs[i], _ = io.ReadAll(r)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	g.Eventually(done, 5*time.Second).Should(gomega.BeClosed())
+	for _, output := range outputs {
+		g.Expect(output).Should(gomega.HaveLen(len(chunk) * len(batches)))
+	}
+}
+
+func TestOutputStreamResume(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	source := &fakeOutputSource{batches: []*outputBatch{
+		{entryId: "1", items: []outputItem{{data: []byte("a")}}},
+		{entryId: "2", items: []outputItem{{data: []byte("b")}}},
+		{entryId: "3", items: []outputItem{{data: []byte("c")}}, eof: true},
+	}}
+	stream := newOutputStream(context.Background(), source.open, "1")
+
+	output, err := io.ReadAll(stream)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).Should(gomega.Equal("bc"))
+	g.Expect(source.lastEntries[0]).Should(gomega.Equal("1"))
+}
+
+func TestOutputStreamRetries(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	// Retryable errors before each batch are retried from the last entry.
+	source := &fakeOutputSource{
+		batches: []*outputBatch{
+			{entryId: "1", items: []outputItem{{data: []byte("a")}}},
+			{entryId: "2", items: []outputItem{{data: []byte("b")}}, eof: true},
+		},
+		failures: map[int][]error{0: {unavailable, unavailable}, 1: {unavailable}},
+	}
+	stream := newOutputStream(context.Background(), source.open, "")
+	output, err := io.ReadAll(stream)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).Should(gomega.Equal("ab"))
+	g.Expect(source.lastEntries).Should(gomega.Equal([]string{"", "", "", "1"}))
+
+	// Non-retryable errors are returned to readers.
+	source = &fakeOutputSource{
+		batches:  []*outputBatch{{entryId: "1", items: []outputItem{{data: []byte("a")}}, eof: true}},
+		failures: map[int][]error{0: {status.Error(codes.PermissionDenied, "denied")}},
+	}
+	stream = newOutputStream(context.Background(), source.open, "")
+	_, err = io.ReadAll(stream)
+	g.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("denied")))
+}
+
+func TestUTF8Decoder(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"ascii", []string{"hello"}, "hello"},
+		{"split character", []string{"\xE2\x82", "\xAC"}, "€"},
+		{"truncated at end", []string{"a\xE2\x82"}, "a�"},
+		{"overlong", []string{"\xC0\xAF"}, "��"},
+		{"invalid second byte", []string{"\xF0\x80\x80"}, "���"},
+		{"surrogate", []string{"\xED\xA0\x80"}, "���"},
+		{"interrupted character", []string{"\xE2\x82", "x"}, "�x"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+			d := &utf8Decoder{}
+			var out []byte
+			for _, chunk := range c.chunks {
+				out = append(out, d.decode([]byte(chunk))...)
+			}
+			out = append(out, d.flush()...)
+			g.Expect(string(out)).Should(gomega.Equal(c.want))
+		})
+	}
+}
+
+func TestOutputStreamModes(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	batches := []*outputBatch{
+		{entryId: "1", items: []outputItem{{data: []byte("\xE2\x82")}}},
+		{entryId: "2", items: []outputItem{{data: []byte("\xAC\xFF\xE2")}}, eof: true},
+	}
+
+	source := &fakeOutputSource{batches: batches}
+	text, err := io.ReadAll(newOutputStream(context.Background(), withStreamMode(source.open, StreamModeText), ""))
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(text)).Should(gomega.Equal("€��"))
+
+	source = &fakeOutputSource{batches: batches}
+	binary, err := io.ReadAll(newOutputStream(context.Background(), withStreamMode(source.open, StreamModeBinary), ""))
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(binary).Should(gomega.Equal([]byte("\xE2\x82\xAC\xFF\xE2")))
+}
@@ -0,0 +1,38 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestAppEphemeral(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppEphemeral(context.Background(), &modal.AppEphemeralOptions{Name: "libmodal-test-ephemeral"})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(app.AppId).Should(gomega.HavePrefix("ap-"))
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{Command: []string{"sleep", "600"}})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	// Closing the App stops its Sandboxes.
+	g.Expect(app.Close()).To(gomega.Succeed())
+	g.Expect(app.Close()).To(gomega.Succeed())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = sb.Wait()
+	}()
+	g.Eventually(done, 60*time.Second).Should(gomega.BeClosed())
+
+	deployed, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(deployed.Close()).Should(gomega.BeAssignableToTypeOf(modal.InvalidError{}))
+}
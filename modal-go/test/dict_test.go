@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestDictEphemeral(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dict, err := modal.DictEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer dict.CloseEphemeral()
+
+	created, err := dict.Put("key", "value", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(created).To(gomega.BeTrue())
+
+	created, err = dict.Put("key", "other", &modal.DictPutOptions{SkipIfExists: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(created).To(gomega.BeFalse())
+
+	v, found, err := dict.Get("key")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(v).To(gomega.Equal("value"))
+
+	n, err := dict.Len()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(n).To(gomega.Equal(1))
+
+	v, found, err = dict.Pop("key")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(v).To(gomega.Equal("value"))
+
+	found, err = dict.Contains("key")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(found).To(gomega.BeFalse())
+
+	_, err = dict.Put(int64(1), []any{int64(2)}, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(dict.Clear()).To(gomega.Succeed())
+	n, err = dict.Len()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(n).To(gomega.Equal(0))
+}
+
+func TestDictLookupAndDelete(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	name := fmt.Sprintf("test-dict-%d", time.Now().UnixNano())
+	_, err := modal.DictLookup(ctx, name, nil)
+	g.Expect(err).Should(gomega.BeAssignableToTypeOf(modal.NotFoundError{}))
+
+	dict, err := modal.DictLookup(ctx, name, &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	_, err = dict.Put("a", int64(1), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	g.Expect(modal.DictDelete(ctx, name, nil)).To(gomega.Succeed())
+	_, err = modal.DictLookup(ctx, name, nil)
+	g.Expect(err).Should(gomega.HaveOccurred())
+}
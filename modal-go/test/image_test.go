@@ -2,7 +2,14 @@ package test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/modal-labs/libmodal/modal-go"
 	"github.com/onsi/gomega"
@@ -77,3 +84,168 @@ func TestImageFromGcpArtifactRegistry(t *testing.T) {
 	g.Expect(err).ShouldNot(gomega.HaveOccurred())
 	g.Expect(image.ImageId).Should(gomega.HavePrefix("im-"))
 }
+
+func TestImageLayers(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	base, err := app.ImageFromRegistry("python:3.13-slim", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image := base.
+		Env(map[string]string{"GREETING": "hello layers"}).
+		Workdir("/srv").
+		RunCommands("echo \"$GREETING\" > greeting.txt")
+	g.Expect(image.ImageId).Should(gomega.BeEmpty())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command: []string{"cat", "greeting.txt"},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+	g.Expect(image.ImageId).Should(gomega.HavePrefix("im-"))
+
+	output, err := io.ReadAll(sb.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).To(gomega.Equal("hello layers\n"))
+
+	// An identical definition reuses the built Image.
+	same := base.
+		Env(map[string]string{"GREETING": "hello layers"}).
+		Workdir("/srv").
+		RunCommands("echo \"$GREETING\" > greeting.txt")
+	sb2, err := app.CreateSandbox(same, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb2.Terminate()
+	g.Expect(same.ImageId).To(gomega.Equal(image.ImageId))
+}
+
+func TestImageFromDockerfile(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":    "FROM alpine:3.21\nARG GREETING=hi\nCOPY . /app\nRUN echo \"$GREETING\" > /app/greeting.txt\n",
+		".dockerignore": "secret.txt\n",
+		"data.txt":      "from context\n",
+		"secret.txt":    "do not upload\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	}
+
+	image := modal.ImageFromDockerfile(filepath.Join(dir, "Dockerfile"), &modal.DockerfileOptions{
+		BuildArgs: map[string]string{"GREETING": "hello dockerfile"},
+	})
+	g.Expect(image.ImageId).Should(gomega.BeEmpty())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command: []string{"sh", "-c", "cat /app/greeting.txt /app/data.txt; ls /app"},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	output, err := io.ReadAll(sb.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).To(gomega.Equal("hello dockerfile\nfrom context\nDockerfile\ndata.txt\ngreeting.txt\n"))
+}
+
+func TestImageBuildLogs(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	base, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	// The marker makes the definition unique, so the Image is always built.
+	marker := fmt.Sprintf("build-log-%d", time.Now().UnixNano())
+	image := base.RunCommands("echo "+marker, "exit 3")
+
+	var output strings.Builder
+	var progress []modal.ImageBuildProgress
+	err = image.Build(app, &modal.ImageBuildOptions{
+		Output:     &output,
+		OnProgress: func(p modal.ImageBuildProgress) { progress = append(progress, p) },
+	})
+	g.Expect(err).Should(gomega.HaveOccurred())
+	g.Expect(err.Error()).Should(gomega.ContainSubstring(marker))
+	g.Expect(output.String()).Should(gomega.ContainSubstring(marker))
+	g.Expect(progress).ShouldNot(gomega.BeEmpty())
+}
+
+func TestImageFromId(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("python:3.13-slim", &modal.ImageFromRegistryOptions{
+		Build: &modal.ImageBuildOptions{ForceBuild: true},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(image.Metadata).ShouldNot(gomega.BeNil())
+	g.Expect(image.Metadata.PythonVersion).Should(gomega.ContainSubstring("3.13"))
+
+	found, err := modal.ImageFromId(context.Background(), image.ImageId)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(found.ImageId).To(gomega.Equal(image.ImageId))
+	err = found.Build(app, &modal.ImageBuildOptions{ForceBuild: true})
+	g.Expect(errors.As(err, &modal.InvalidError{})).To(gomega.BeTrue())
+
+	_, err = modal.ImageFromId(context.Background(), "im-nonexistent")
+	g.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestImageBuildTimeout(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	base, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image := base.RunCommands(fmt.Sprintf("echo %d", time.Now().UnixNano()), "sleep 60")
+	err = image.Build(app, &modal.ImageBuildOptions{Timeout: 5 * time.Second})
+	var timeoutErr modal.ImageBuildTimeoutError
+	g.Expect(errors.As(err, &timeoutErr)).To(gomega.BeTrue())
+	g.Expect(image.ImageId).Should(gomega.BeEmpty())
+}
+
+func TestImageFromRegistryLazy(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image := modal.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(image.ImageId).Should(gomega.BeEmpty())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{Command: []string{"echo", "lazy"}})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+	g.Expect(image.ImageId).Should(gomega.HavePrefix("im-"))
+
+	output, err := io.ReadAll(sb.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).To(gomega.Equal("lazy\n"))
+
+	// The same definition built eagerly in the same App is the same Image.
+	eager, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(eager.ImageId).To(gomega.Equal(image.ImageId))
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dict, err := modal.DictEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer dict.CloseEphemeral()
+
+	a := modal.NewLock(dict, "leader", &modal.LockOptions{Holder: "a"})
+	b := modal.NewLock(dict, "leader", &modal.LockOptions{Holder: "b"})
+
+	leaseA, err := a.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseA).ShouldNot(gomega.BeNil())
+	g.Expect(leaseA.Valid()).To(gomega.BeTrue())
+
+	leaseB, err := b.TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseB).Should(gomega.BeNil())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = b.Acquire(ctx)
+	g.Expect(err).Should(gomega.MatchError(context.DeadlineExceeded))
+
+	g.Expect(leaseA.Renew()).To(gomega.Succeed())
+	g.Expect(leaseA.Release()).To(gomega.Succeed())
+	g.Expect(leaseA.Done()).To(gomega.BeClosed())
+
+	leaseB, err = b.Acquire(context.Background())
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(leaseB.Token).To(gomega.BeNumerically(">", leaseA.Token))
+	g.Expect(leaseB.Release()).To(gomega.Succeed())
+}
+
+func TestLockExpiry(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dict, err := modal.DictEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer dict.CloseEphemeral()
+
+	options := &modal.LockOptions{TTL: 2 * time.Second, RenewInterval: -1}
+	stale, err := modal.NewLock(dict, "leader", options).TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(stale).ShouldNot(gomega.BeNil())
+
+	// Without renewal, the lease expires and another worker takes over.
+	lease, err := modal.NewLock(dict, "leader", nil).Acquire(context.Background())
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer lease.Release()
+	g.Expect(lease.Token).To(gomega.Equal(stale.Token + 1))
+
+	g.Expect(stale.Valid()).To(gomega.BeFalse())
+	g.Expect(stale.Renew()).Should(gomega.HaveOccurred())
+	g.Expect(stale.Done()).To(gomega.BeClosed())
+
+	// Background renewal keeps the new lease valid past its TTL.
+	renewed, err := modal.NewLock(dict, "renewed", &modal.LockOptions{TTL: 2 * time.Second}).TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	time.Sleep(3 * time.Second)
+	g.Expect(renewed.Valid()).To(gomega.BeTrue())
+	other, err := modal.NewLock(dict, "renewed", nil).TryAcquire()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(other).Should(gomega.BeNil())
+	g.Expect(renewed.Release()).To(gomega.Succeed())
+}
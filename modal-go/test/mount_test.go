@@ -0,0 +1,46 @@
+package test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestSandboxWithMount(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello from mount\n"), 0o644)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	err = os.WriteFile(filepath.Join(dir, "ignored.log"), []byte("ignored\n"), 0o644)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	mount, err := modal.MountFromLocalDir(context.Background(), dir, "/mnt/data", &modal.MountOptions{
+		Ignore: []string{"*.log"},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(mount.MountId).Should(gomega.HavePrefix("mo-"))
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command: []string{"sh", "-c", "cat /mnt/data/hello.txt; ls /mnt/data"},
+		Mounts:  []*modal.Mount{mount},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	output, err := io.ReadAll(sb.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).To(gomega.Equal("hello from mount\nhello.txt\n"))
+}
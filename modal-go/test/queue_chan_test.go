@@ -0,0 +1,62 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestQueueSinkAndChan(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	queue, err := modal.QueueEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer queue.CloseEphemeral()
+
+	sink, wait := queue.Sink(context.Background(), &modal.QueueSinkOptions{MaxBatchSize: 3})
+	for i := range 10 {
+		sink <- int64(i)
+		if i == 4 {
+			// Values that can't be pickled are reported, and later values are still put.
+			sink <- make(chan int)
+		}
+	}
+	close(sink)
+	g.Expect(wait()).To(gomega.MatchError(gomega.ContainSubstring("error pickling data")))
+
+	n, err := queue.Len(nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(n).To(gomega.Equal(10))
+
+	// Peeking leaves the items in the queue.
+	ctx, cancel := context.WithCancel(context.Background())
+	items, errFn := queue.Chan(ctx, &modal.QueueChanOptions{Peek: true})
+	for i := range 10 {
+		g.Expect(<-items).To(gomega.Equal(int64(i)))
+	}
+	cancel()
+	g.Expect(errFn()).To(gomega.Succeed())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	items, errFn = queue.Chan(ctx, &modal.QueueChanOptions{BatchSize: 4, PollTimeout: time.Second})
+	var got []any
+	for v := range items {
+		got = append(got, v)
+		if len(got) == 5 {
+			cancel()
+			break
+		}
+	}
+	g.Expect(errFn()).To(gomega.Succeed())
+	g.Expect(got).To(gomega.Equal([]any{int64(0), int64(1), int64(2), int64(3), int64(4)}))
+
+	// Items that were removed but not received are put back.
+	n, err = queue.Len(nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(n).To(gomega.Equal(5))
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestQueueConsumer(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	queue, err := modal.QueueEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer queue.CloseEphemeral()
+	deadLetter, err := modal.QueueEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer deadLetter.CloseEphemeral()
+
+	jobs := modal.QueueOf[string](queue, nil)
+	g.Expect(jobs.PutMany([]string{"ok-1", "flaky", "poison", "ok-2"}, nil)).To(gomega.Succeed())
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	var done []string
+	consumer := modal.NewQueueConsumer(jobs, func(ctx context.Context, job string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[job]++
+		if job == "poison" || (job == "flaky" && attempts[job] == 1) {
+			return errors.New("job failed")
+		}
+		done = append(done, job)
+		return nil
+	}, &modal.QueueConsumerOptions{
+		Concurrency: 2,
+		MaxRetries:  2,
+		PollTimeout: time.Second,
+		DeadLetter:  deadLetter,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- consumer.Run(ctx) }()
+
+	g.Eventually(func() int64 {
+		stats, err := consumer.Stats()
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		return stats.Processed + stats.DeadLettered
+	}, 60*time.Second, 500*time.Millisecond).Should(gomega.Equal(int64(4)))
+	cancel()
+	g.Expect(<-runErr).ShouldNot(gomega.HaveOccurred())
+
+	g.Expect(done).To(gomega.ConsistOf("ok-1", "ok-2", "flaky"))
+	g.Expect(attempts["poison"]).To(gomega.Equal(3))
+
+	stats, err := consumer.Stats()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(stats.Failed).To(gomega.Equal(int64(4)))
+	g.Expect(stats.Retried).To(gomega.Equal(int64(3)))
+	g.Expect(stats.Pending).To(gomega.Equal(0))
+
+	// Dead-lettered items are stored without their retry count.
+	item, err := modal.QueueOf[string](deadLetter, nil).Get(nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(item).To(gomega.Equal("poison"))
+}
@@ -3,6 +3,7 @@ package test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -169,3 +170,128 @@ func TestQueueNonBlocking(t *testing.T) {
 	g.Expect(err).ToNot(gomega.HaveOccurred())
 	g.Expect(item).To(gomega.Equal(int64(123)))
 }
+
+type queueTask struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+}
+
+func TestTypedQueue(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	queue, err := modal.QueueEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer queue.CloseEphemeral()
+
+	tasks := modal.QueueOf[queueTask](queue, nil)
+	err = tasks.PutMany([]queueTask{{Name: "a", Priority: 1}, {Name: "b", Priority: 2}}, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	// Items that don't decode as the type are reported per item.
+	err = queue.Put("not a task", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	var names []string
+	var decodeErrors int
+	for task, err := range tasks.Iterate(nil) {
+		var decodeErr modal.QueueDecodeError
+		if errors.As(err, &decodeErr) {
+			decodeErrors++
+			continue
+		}
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		names = append(names, task.Name)
+	}
+	g.Expect(names).To(gomega.Equal([]string{"a", "b"}))
+	g.Expect(decodeErrors).To(gomega.Equal(1))
+
+	task, err := tasks.Get(nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(task).To(gomega.Equal(queueTask{Name: "a", Priority: 1}))
+
+	// Untyped reads see structs as Python dicts.
+	raw, err := queue.Get(nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(raw).To(gomega.Equal(map[any]any{"name": "b", "priority": int64(2)}))
+
+	jsonTasks := modal.QueueOf(queue, modal.JSONCodec[queueTask]())
+	g.Expect(jsonTasks.Put(queueTask{Name: "c"}, nil)).To(gomega.Succeed())
+	tasksOut, err := jsonTasks.GetMany(10, nil)
+	var decodeErr modal.QueueDecodeError
+	g.Expect(errors.As(err, &decodeErr)).To(gomega.BeTrue()) // the pickled string
+	g.Expect(tasksOut).To(gomega.Equal([]queueTask{{Name: "c"}}))
+}
+
+func TestQueueListAndDelete(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	name := fmt.Sprintf("test-queue-list-%d", time.Now().UnixNano())
+	queue, err := modal.QueueLookup(ctx, name, &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(queue.PutMany([]any{1, 2}, nil)).To(gomega.Succeed())
+
+	queues, err := modal.QueueList(ctx, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	var found *modal.QueueInfo
+	for i := range queues {
+		if queues[i].Name == name {
+			found = &queues[i]
+		}
+	}
+	g.Expect(found).ShouldNot(gomega.BeNil())
+	g.Expect(found.TotalSize).To(gomega.Equal(2))
+	g.Expect(found.CreatedAt).ShouldNot(gomega.BeZero())
+
+	// Options may be nil.
+	g.Expect(modal.QueueDelete(ctx, name, nil)).To(gomega.Succeed())
+	_, err = modal.QueueLookup(ctx, name, nil)
+	g.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestQueueIterateEntries(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	queue, err := modal.QueueEphemeral(context.Background(), nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer queue.CloseEphemeral()
+
+	g.Expect(queue.Put(1, nil)).To(gomega.Succeed())
+	g.Expect(modal.QueueOf(queue, modal.BytesCodec()).Put([]byte("not a pickle"), nil)).To(gomega.Succeed())
+	g.Expect(queue.Put(2, nil)).To(gomega.Succeed())
+
+	// Decode errors are yielded, and iteration continues.
+	var values []any
+	var decodeErrors int
+	for v, err := range queue.Iterate(nil) {
+		var decodeErr modal.QueueDecodeError
+		if errors.As(err, &decodeErr) {
+			g.Expect(decodeErr.Data).To(gomega.Equal([]byte("not a pickle")))
+			decodeErrors++
+			continue
+		}
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		values = append(values, v)
+	}
+	g.Expect(values).To(gomega.Equal([]any{int64(1), int64(2)}))
+	g.Expect(decodeErrors).To(gomega.Equal(1))
+
+	// Resume after the first entry.
+	var first modal.QueueEntry
+	for entry, err := range queue.IterateEntries(nil) {
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		first = entry
+		break
+	}
+	g.Expect(first.EntryId).ShouldNot(gomega.BeEmpty())
+	values = nil
+	for v, err := range queue.Iterate(&modal.QueueIterateOptions{LastEntryId: first.EntryId}) {
+		if err == nil {
+			values = append(values, v)
+		}
+	}
+	g.Expect(values).To(gomega.Equal([]any{int64(2)}))
+}
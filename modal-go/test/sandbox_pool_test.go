@@ -0,0 +1,64 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestSandboxPool(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	app, err := modal.AppLookup(ctx, "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	pool, err := modal.NewSandboxPool(app, image, &modal.SandboxPoolOptions{Size: 1, MaxSize: 2})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer pool.Close()
+
+	sb1, err := pool.Acquire(ctx)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	sb2, err := pool.Acquire(ctx)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(sb2.SandboxId).ShouldNot(gomega.Equal(sb1.SandboxId))
+
+	// The pool is at its max size, so Acquire blocks until the context is done.
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	_, err = pool.Acquire(timeoutCtx)
+	g.Expect(err).Should(gomega.MatchError(context.DeadlineExceeded))
+
+	// A reused Sandbox is handed out again.
+	err = pool.Release(sb1, true)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	sb3, err := pool.Acquire(ctx)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(sb3.SandboxId).Should(gomega.Equal(sb1.SandboxId))
+
+	// A Sandbox that is not reused is terminated.
+	err = pool.Release(sb2, false)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	exitCode, err := sb2.Wait()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(exitCode).Should(gomega.Equal(137))
+
+	err = pool.Release(sb2, true)
+	g.Expect(errors.As(err, &modal.InvalidError{})).Should(gomega.BeTrue())
+
+	err = pool.Close()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	_, err = sb3.Wait()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	_, err = pool.Acquire(ctx)
+	g.Expect(errors.As(err, &modal.InvalidError{})).Should(gomega.BeTrue())
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/modal-labs/libmodal/modal-go"
+	"github.com/onsi/gomega"
+)
+
+func TestSandboxSnapshotAndRestore(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	app, err := modal.AppLookup(ctx, "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{EnableSnapshot: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	p, err := sb.Exec([]string{"sh", "-c", "echo -n 'warm' > /tmp/state.txt"}, modal.ExecOptions{})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	_, err = p.Wait()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	snapshot, err := sb.Snapshot()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(snapshot.SnapshotId).ShouldNot(gomega.BeEmpty())
+
+	err = snapshot.Wait(55 * time.Second)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	snapshotFromId, err := modal.SandboxSnapshotFromId(ctx, snapshot.SnapshotId)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(snapshotFromId.SnapshotId).Should(gomega.Equal(snapshot.SnapshotId))
+
+	restored, err := modal.SandboxRestore(ctx, snapshotFromId)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer restored.Terminate()
+	g.Expect(restored.SandboxId).ShouldNot(gomega.Equal(sb.SandboxId))
+
+	p, err = restored.Exec([]string{"cat", "/tmp/state.txt"}, modal.ExecOptions{})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	output, err := io.ReadAll(p.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).Should(gomega.Equal("warm"))
+}
@@ -2,7 +2,13 @@ package test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -320,3 +326,473 @@ func TestSandboxFromId(t *testing.T) {
 	g.Expect(err).ShouldNot(gomega.HaveOccurred())
 	g.Expect(sbFromId.SandboxId).Should(gomega.Equal(sb.SandboxId))
 }
+
+func TestSandboxSetTagsAndList(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	app, err := modal.AppLookup(ctx, "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	unique := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	err = sb.SetTags(map[string]string{"test-key": unique})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	var found []*modal.Sandbox
+	for listed, err := range modal.SandboxList(ctx, &modal.SandboxListOptions{
+		AppId: app.AppId,
+		Tags:  map[string]string{"test-key": unique},
+	}) {
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		found = append(found, listed)
+	}
+	g.Expect(found).Should(gomega.HaveLen(1))
+	g.Expect(found[0].SandboxId).Should(gomega.Equal(sb.SandboxId))
+	g.Expect(found[0].AppId).Should(gomega.Equal(app.AppId))
+	g.Expect(found[0].Tags).Should(gomega.HaveKeyWithValue("test-key", unique))
+	g.Expect(found[0].CreatedAt).ShouldNot(gomega.BeZero())
+	g.Expect(found[0].State).ShouldNot(gomega.Equal(modal.SandboxStateFinished))
+}
+
+func TestSandboxResourceUsage(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{Command: []string{"sh", "-c", "sleep 2"}})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	_, err = sb.Wait()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	usage, err := sb.ResourceUsage()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(usage.MemoryGiBTime).Should(gomega.BeNumerically(">", 0))
+	g.Expect(usage.MemoryGiBHours()).Should(gomega.BeNumerically(">", 0))
+	g.Expect(usage.GPUTime).Should(gomega.BeZero())
+	g.Expect(usage.GPUType).Should(gomega.BeEmpty())
+}
+
+func TestSandboxWaitReady(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("python:3.13-alpine", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command:        []string{"sh", "-c", "sleep 2 && touch /tmp/ready && python -m http.server 8000"},
+		EncryptedPorts: []int{8000},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	options := &modal.WaitReadyOptions{Interval: 500 * time.Millisecond, Timeout: time.Minute}
+	g.Expect(sb.WaitReady(modal.ProbeFile("/tmp/ready"), options)).ShouldNot(gomega.HaveOccurred())
+	g.Expect(sb.WaitReady(modal.ProbeCommand([]string{"test", "-f", "/tmp/ready"}), options)).ShouldNot(gomega.HaveOccurred())
+	g.Expect(sb.WaitReady(modal.ProbeHTTP(8000, "/"), options)).ShouldNot(gomega.HaveOccurred())
+	g.Expect(sb.WaitReady(modal.ProbeTCP(8000), options)).ShouldNot(gomega.HaveOccurred())
+
+	err = sb.WaitReady(modal.ProbeFile("/tmp/missing"), &modal.WaitReadyOptions{Timeout: 2 * time.Second})
+	g.Expect(errors.As(err, &modal.SandboxTimeoutError{})).Should(gomega.BeTrue())
+}
+
+func TestSandboxWaitReadyExited(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{Command: []string{"sh", "-c", "exit 1"}})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	err = sb.WaitReady(modal.ProbeFile("/tmp/never"), &modal.WaitReadyOptions{Timeout: time.Minute})
+	g.Expect(errors.As(err, &modal.ExecutionError{})).Should(gomega.BeTrue())
+}
+
+func TestSandboxWaitResult(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{Command: []string{"sh", "-c", "exit 137"}})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	result, err := sb.WaitResult()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(result.Status).Should(gomega.Equal(modal.SandboxStatusFailure))
+	g.Expect(result.ExitCode).Should(gomega.Equal(137))
+	g.Expect(result.FinishedAt).ShouldNot(gomega.BeZero())
+
+	sb2, err := app.CreateSandbox(image, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	pollResult, err := sb2.PollResult()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(pollResult).Should(gomega.BeNil())
+
+	err = sb2.Terminate()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	result, err = sb2.WaitResult()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(result.Status).Should(gomega.Equal(modal.SandboxStatusTerminated))
+}
+
+func TestSandboxForwardAndDial(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("python:3.13-alpine", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command:        []string{"python", "-m", "http.server", "8000"},
+		EncryptedPorts: []int{8000},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	err = sb.WaitReady(modal.ProbeHTTP(8000, "/"), &modal.WaitReadyOptions{Timeout: time.Minute})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	httpClient := &http.Client{Transport: &http.Transport{DialContext: sb.DialContext}}
+	resp, err := httpClient.Get("http://sandbox:8000/")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	resp.Body.Close()
+	g.Expect(resp.StatusCode).Should(gomega.Equal(http.StatusOK))
+
+	forward, err := sb.Forward("127.0.0.1:0", 8000)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer forward.Close()
+
+	resp, err = http.Get("http://" + forward.Addr().String() + "/")
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	resp.Body.Close()
+	g.Expect(resp.StatusCode).Should(gomega.Equal(http.StatusOK))
+
+	_, err = sb.Forward("127.0.0.1:0", 9999)
+	g.Expect(errors.As(err, &modal.InvalidError{})).Should(gomega.BeTrue())
+}
+
+func TestSandboxDialConcurrent(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("python:3.13-alpine", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command:        []string{"python", "-m", "http.server", "8000"},
+		EncryptedPorts: []int{8000},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	err = sb.WaitReady(modal.ProbeHTTP(8000, "/"), &modal.WaitReadyOptions{Timeout: time.Minute})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	// A fresh handle looks up its Tunnels on the first of the concurrent dials.
+	fresh, err := modal.SandboxFromId(context.Background(), sb.SandboxId)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	httpClient := &http.Client{Transport: &http.Transport{DialContext: fresh.DialContext}}
+
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() {
+			resp, err := httpClient.Get("http://sandbox:8000/")
+			if err == nil {
+				resp.Body.Close()
+			}
+			errs <- err
+		}()
+	}
+	for range cap(errs) {
+		g.Expect(<-errs).ShouldNot(gomega.HaveOccurred())
+	}
+}
+
+func TestContainerProcessConn(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	p, err := sb.Exec([]string{"cat"}, modal.ExecOptions{})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	conn := p.Conn(nil)
+	var _ net.Conn = conn
+
+	// Nothing has been written yet, so a read times out.
+	err = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	_, err = conn.Read(make([]byte, 1))
+	g.Expect(errors.Is(err, os.ErrDeadlineExceeded)).Should(gomega.BeTrue())
+	err = conn.SetReadDeadline(time.Time{})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	// Many small writes are coalesced, then read back after a half-close.
+	for i := range 100 {
+		_, err = fmt.Fprintf(conn, "line %d\n", i)
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	}
+	err = conn.CloseWrite()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	output, err := io.ReadAll(conn)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(strings.Count(string(output), "\n")).Should(gomega.Equal(100))
+	g.Expect(string(output)).Should(gomega.HavePrefix("line 0\nline 1\n"))
+
+	err = conn.Close()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	exitCode, err := p.Wait()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(exitCode).Should(gomega.Equal(0))
+}
+
+func TestContainerProcessConnBinary(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	// The exec is in text mode, but the conn passes bytes through unchanged.
+	p, err := sb.Exec([]string{"cat"}, modal.ExecOptions{Mode: modal.StreamModeText})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	conn := p.Conn(nil)
+	defer conn.Close()
+	data := []byte("\xff\xfe\x00binary\xc3")
+	_, err = conn.Write(data)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(conn.CloseWrite()).To(gomega.Succeed())
+
+	output, err := io.ReadAll(conn)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(output).Should(gomega.Equal(data))
+}
+
+func TestSandboxOutputStreamTeeAndResume(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command: []string{"sh", "-c", "echo first; sleep 2; echo second"},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	tee := sb.Stdout.NewReader()
+	teeOutput := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(tee)
+		teeOutput <- string(b)
+	}()
+
+	buf := make([]byte, len("first\n"))
+	_, err = io.ReadFull(sb.Stdout, buf)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(buf)).Should(gomega.Equal("first\n"))
+	g.Eventually(sb.Stdout.LastEntryId).ShouldNot(gomega.BeEmpty())
+	lastEntryId := sb.Stdout.LastEntryId()
+
+	rest, err := io.ReadAll(sb.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(rest)).Should(gomega.Equal("second\n"))
+	g.Expect(<-teeOutput).Should(gomega.Equal("first\nsecond\n"))
+
+	// Reopen the stream after the first entry, as if after a restart.
+	sbFromId, err := modal.SandboxFromId(context.Background(), sb.SandboxId)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	resumed := sbFromId.OutputStream(modal.FileDescriptorStdout, &modal.OutputStreamOptions{LastEntryId: lastEntryId})
+	output, err := io.ReadAll(resumed)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).Should(gomega.Equal("second\n"))
+}
+
+func TestSandboxLogsAndExecLines(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Command: []string{"sh", "-c", "printf 'one\\ntw'; sleep 1; printf 'o\\nthree'; echo err >&2"},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	var lines []modal.LogLine
+	for line, err := range sb.Logs(nil) {
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		lines = append(lines, line)
+	}
+	g.Expect(lines).Should(gomega.HaveLen(3))
+	g.Expect(lines[0].Text).Should(gomega.Equal("one"))
+	g.Expect(lines[1].Text).Should(gomega.Equal("two"))
+	g.Expect(lines[2].Text).Should(gomega.Equal("three"))
+	g.Expect(lines[0].Stream).Should(gomega.Equal(modal.FileDescriptorStdout))
+	g.Expect(lines[0].Timestamp).ShouldNot(gomega.BeZero())
+	g.Expect(lines[0].EntryId).ShouldNot(gomega.BeEmpty())
+
+	var stderrLines []string
+	for line, err := range sb.Logs(&modal.LogsOptions{FileDescriptor: modal.FileDescriptorStderr}) {
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		stderrLines = append(stderrLines, line.Text)
+	}
+	g.Expect(stderrLines).Should(gomega.Equal([]string{"err"}))
+
+	sb2, err := app.CreateSandbox(image, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb2.Terminate()
+
+	p, err := sb2.Exec([]string{"sh", "-c", "seq 1 3"}, modal.ExecOptions{})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	var execLines []string
+	for line, err := range p.Lines(modal.FileDescriptorStdout) {
+		g.Expect(err).ShouldNot(gomega.HaveOccurred())
+		execLines = append(execLines, line.Text)
+	}
+	g.Expect(execLines).Should(gomega.Equal([]string{"1", "2", "3"}))
+}
+
+func TestSandboxExecStreamModes(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer sb.Terminate()
+
+	command := []string{"printf", `\342\202\254\377`}
+
+	// Output is raw bytes by default.
+	p, err := sb.Exec(command, modal.ExecOptions{})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	binary, err := io.ReadAll(p.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(binary).To(gomega.Equal([]byte("\xE2\x82\xAC\xFF")))
+
+	p, err = sb.Exec(command, modal.ExecOptions{Mode: modal.StreamModeText})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	text, err := io.ReadAll(p.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(text)).To(gomega.Equal("€�"))
+}
+
+func TestSandboxTerminate(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{Command: []string{"sleep", "60"}})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	done := sb.Done()
+
+	g.Expect(sb.Terminate()).Should(gomega.Succeed())
+	g.Expect(sb.Terminate()).Should(gomega.Succeed())
+	g.Eventually(done).Should(gomega.BeClosed())
+
+	_, err = sb.Exec([]string{"echo", "hi"}, modal.ExecOptions{})
+	var terminatedErr modal.SandboxTerminatedError
+	g.Expect(errors.As(err, &terminatedErr)).To(gomega.BeTrue())
+
+	result, err := sb.WaitResult()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(result.Status).To(gomega.Equal(modal.SandboxStatusTerminated))
+}
+
+func TestSandboxTerminateOnContextDone(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	app, err := modal.AppLookup(context.Background(), "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	// The Sandbox is bound to the context of a single request, not the App.
+	ctx, cancel := context.WithCancel(context.Background())
+	sb, err := app.CreateSandboxContext(ctx, image, &modal.SandboxOptions{
+		Command:                []string{"sleep", "60"},
+		TerminateOnContextDone: true,
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	cancel()
+	g.Eventually(sb.Done(), 30*time.Second).Should(gomega.BeClosed())
+
+	sb, err = modal.SandboxFromId(context.Background(), sb.SandboxId)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	result, err := sb.WaitResult()
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(result.Status).To(gomega.Equal(modal.SandboxStatusTerminated))
+}
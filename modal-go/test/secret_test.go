@@ -2,7 +2,13 @@ package test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/modal-labs/libmodal/modal-go"
 	"github.com/onsi/gomega"
@@ -33,3 +39,64 @@ func TestSecretFromNameWithRequiredKeys(t *testing.T) {
 	})
 	g.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("Secret is missing key(s): missing-key")))
 }
+
+func TestSecretFromMap(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	dotenv := filepath.Join(t.TempDir(), ".env")
+	g.Expect(os.WriteFile(dotenv, []byte("FROM_FILE='from file'\n"), 0o644)).To(gomega.Succeed())
+
+	fromMap, err := modal.SecretFromMap(ctx, map[string]string{"FROM_MAP": "from map"}, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(fromMap.SecretId).Should(gomega.HavePrefix("st-"))
+	fromFile, err := modal.SecretFromDotenv(ctx, dotenv, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	app, err := modal.AppLookup(ctx, "libmodal-test", &modal.LookupOptions{CreateIfMissing: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	image, err := app.ImageFromRegistry("alpine:3.21", nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	sb, err := app.CreateSandbox(image, &modal.SandboxOptions{
+		Secrets: []*modal.Secret{fromMap, fromFile},
+		Command: []string{"printenv", "FROM_MAP", "FROM_FILE"},
+	})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	output, err := io.ReadAll(sb.Stdout)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(string(output)).To(gomega.Equal("from map\nfrom file\n"))
+}
+
+func TestSecretCreateListDelete(t *testing.T) {
+	t.Parallel()
+	g := gomega.NewWithT(t)
+	ctx := context.Background()
+
+	name := fmt.Sprintf("test-secret-%d", time.Now().UnixNano())
+	secret, err := modal.SecretCreate(ctx, name, map[string]string{"a": "1"}, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	g.Expect(secret.SecretId).Should(gomega.HavePrefix("st-"))
+
+	_, err = modal.SecretCreate(ctx, name, map[string]string{"a": "2"}, nil)
+	var existsErr modal.AlreadyExistsError
+	g.Expect(errors.As(err, &existsErr)).To(gomega.BeTrue())
+
+	_, err = modal.SecretCreate(ctx, name, map[string]string{"b": "2"}, &modal.SecretCreateOptions{Overwrite: true})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	_, err = modal.SecretFromName(ctx, name, &modal.SecretFromNameOptions{RequiredKeys: []string{"b"}})
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	secrets, err := modal.SecretList(ctx, nil)
+	g.Expect(err).ShouldNot(gomega.HaveOccurred())
+	var names []string
+	for _, s := range secrets {
+		names = append(names, s.Name)
+	}
+	g.Expect(names).To(gomega.ContainElement(name))
+
+	g.Expect(modal.SecretDelete(ctx, name, nil)).To(gomega.Succeed())
+	_, err = modal.SecretFromName(ctx, name, nil)
+	g.Expect(err).Should(gomega.HaveOccurred())
+}